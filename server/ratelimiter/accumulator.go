@@ -0,0 +1,98 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Accumulator is a Throttler that sums up the delays and counts the errors
+// of all results returned by the wrapped throttler, e.g. for reporting the
+// time a batch of calls has spent being throttled. Delays of results
+// carrying an error are not added as such calls do not wait. It is safe for
+// concurrent use, so it can be shared by a pool of workers.
+type Accumulator struct {
+	next   Throttler
+	lock   sync.Mutex
+	total  time.Duration
+	errors int
+}
+
+// NewAccumulator creates a new Accumulator wrapping next.
+func NewAccumulator(next Throttler) *Accumulator {
+	return &Accumulator{next: next}
+}
+
+// Total returns the sum of the delays of all results received so far that
+// did not carry an error.
+func (a *Accumulator) Total() time.Duration {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.total
+}
+
+// Errors returns the number of results received so far that carried an
+// error.
+func (a *Accumulator) Errors() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.errors
+}
+
+// Reset sets the total delay and error count back to zero.
+func (a *Accumulator) Reset() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.total = 0
+	a.errors = 0
+}
+
+// LinearThrottle linearly throttles using the wrapped Throttler.
+func (a *Accumulator) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return a.accumulate(a.next.LinearThrottle(threshold, identifier))
+}
+
+// ExponentialThrottle exponentially throttles using the wrapped Throttler.
+func (a *Accumulator) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return a.accumulate(a.next.ExponentialThrottle(threshold, identifier))
+}
+
+// LinearThrottleCtx works like LinearThrottle, but stops waiting as soon as
+// the given context is cancelled.
+func (a *Accumulator) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return a.accumulate(LinearThrottleCtx(ctx, a.next, threshold, identifier))
+}
+
+// ExponentialThrottleCtx works like ExponentialThrottle, but stops waiting
+// as soon as the given context is cancelled.
+func (a *Accumulator) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return a.accumulate(ExponentialThrottleCtx(ctx, a.next, threshold, identifier))
+}
+
+// Close closes the wrapped Throttler in case it implements Closer.
+func (a *Accumulator) Close(ctx context.Context) error {
+	if c, ok := a.next.(Closer); ok {
+		return c.Close(ctx)
+	}
+	return nil
+}
+
+func (a *Accumulator) accumulate(in <-chan Result) <-chan Result {
+	out := make(chan Result, 1)
+	go func() {
+		defer close(out)
+		result := <-in
+		a.lock.Lock()
+		if result.Error != nil {
+			a.errors++
+		} else {
+			a.total += result.Delay
+		}
+		a.lock.Unlock()
+		out <- result
+	}()
+	return out
+}
@@ -0,0 +1,39 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAccumulator(t *testing.T) {
+	limiter, _ := NewLimiter(50*time.Millisecond, &mockGetSetter{})
+	accumulator := NewAccumulator(limiter)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-accumulator.LinearThrottle(20*time.Millisecond, "batch")
+		}()
+	}
+	wg.Wait()
+	<-accumulator.LinearThrottle(time.Minute, "other")
+	<-accumulator.LinearThrottle(time.Minute, "other")
+
+	if total := accumulator.Total(); total < 55*time.Millisecond || total > 65*time.Millisecond {
+		t.Errorf("Expected total of about %v, got %v", 60*time.Millisecond, total)
+	}
+	if errors := accumulator.Errors(); errors != 1 {
+		t.Errorf("Expected %v errors, got %v", 1, errors)
+	}
+
+	accumulator.Reset()
+	if total := accumulator.Total(); total != 0 {
+		t.Errorf("Expected %v, got %v", 0, total)
+	}
+}
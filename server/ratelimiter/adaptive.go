@@ -0,0 +1,111 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// AdaptiveLimiter is a Throttler that scales the thresholds passed to the
+// wrapped throttler according to feedback about the health of the resource
+// being protected. The scaling follows AIMD: each reported failure
+// multiplies the factor applied to thresholds by increase, up to max, and
+// each reported success decreases the factor by decrease until it is back
+// at 1, i.e. the configured thresholds. Sustained failures therefore
+// quickly slow down callers, while sustained successes relax the limit
+// gradually. The factor is kept in memory and is not shared across
+// instances.
+type AdaptiveLimiter struct {
+	next     Throttler
+	increase float64
+	decrease float64
+	max      float64
+	lock     sync.Mutex
+	factor   float64
+}
+
+// NewAdaptiveLimiter creates a new AdaptiveLimiter wrapping next. Values of
+// increase smaller than 1 and values of max smaller than 1 are treated as 1
+// and disable adaptation.
+func NewAdaptiveLimiter(next Throttler, increase, decrease, max float64) *AdaptiveLimiter {
+	if increase < 1 {
+		increase = 1
+	}
+	if max < 1 {
+		max = 1
+	}
+	if decrease < 0 {
+		decrease = 0
+	}
+	return &AdaptiveLimiter{
+		next:     next,
+		increase: increase,
+		decrease: decrease,
+		max:      max,
+		factor:   1,
+	}
+}
+
+// ReportSuccess relaxes the factor applied to thresholds by decrease.
+func (a *AdaptiveLimiter) ReportSuccess() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.factor -= a.decrease
+	if a.factor < 1 {
+		a.factor = 1
+	}
+}
+
+// ReportFailure multiplies the factor applied to thresholds by increase.
+func (a *AdaptiveLimiter) ReportFailure() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.factor *= a.increase
+	if a.factor > a.max {
+		a.factor = a.max
+	}
+}
+
+// Factor returns the factor currently applied to thresholds.
+func (a *AdaptiveLimiter) Factor() float64 {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.factor
+}
+
+func (a *AdaptiveLimiter) scale(threshold time.Duration) time.Duration {
+	return time.Duration(float64(threshold) * a.Factor())
+}
+
+// LinearThrottle linearly throttles using the scaled threshold.
+func (a *AdaptiveLimiter) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return a.next.LinearThrottle(a.scale(threshold), identifier)
+}
+
+// ExponentialThrottle exponentially throttles using the scaled threshold.
+func (a *AdaptiveLimiter) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return a.next.ExponentialThrottle(a.scale(threshold), identifier)
+}
+
+// LinearThrottleCtx works like LinearThrottle, but stops waiting as soon as
+// the given context is cancelled.
+func (a *AdaptiveLimiter) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return LinearThrottleCtx(ctx, a.next, a.scale(threshold), identifier)
+}
+
+// ExponentialThrottleCtx works like ExponentialThrottle, but stops waiting
+// as soon as the given context is cancelled.
+func (a *AdaptiveLimiter) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return ExponentialThrottleCtx(ctx, a.next, a.scale(threshold), identifier)
+}
+
+// Close closes the wrapped Throttler in case it implements Closer.
+func (a *AdaptiveLimiter) Close(ctx context.Context) error {
+	if c, ok := a.next.(Closer); ok {
+		return c.Close(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiter(t *testing.T) {
+	limiter, _ := NewLimiter(time.Millisecond, &mockGetSetter{})
+	adaptive := NewAdaptiveLimiter(limiter, 2, 1, 8)
+
+	delay := func(identifier string) time.Duration {
+		<-adaptive.LinearThrottle(time.Minute, identifier)
+		return (<-adaptive.LinearThrottle(time.Minute, identifier)).Delay
+	}
+
+	previous := delay("initial")
+	for i := 0; i < 3; i++ {
+		adaptive.ReportFailure()
+		next := delay(fmt.Sprintf("failure-%d", i))
+		if next <= previous {
+			t.Errorf("Expected delay to grow after failure %d, got %v after %v", i, next, previous)
+		}
+		previous = next
+	}
+	adaptive.ReportFailure()
+	if factor := adaptive.Factor(); factor != 8 {
+		t.Errorf("Expected factor to be capped at %v, got %v", 8, factor)
+	}
+
+	for i := 0; i < 10; i++ {
+		adaptive.ReportSuccess()
+	}
+	if factor := adaptive.Factor(); factor != 1 {
+		t.Errorf("Expected factor to relax to %v, got %v", 1, factor)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"time"
+)
+
+// Penalize moves the time until which calls using the given identifier are
+// delayed forward by extra, starting from now in case no limit is currently
+// stored. Identifiers that have been blocked using Block are not affected.
+func (l *Limiter) Penalize(identifier string, extra time.Duration) error {
+	return l.adjust(identifier, true, func(now time.Time, item cacheItem) cacheItem {
+		if item.blockUntil.Before(now) {
+			item.blockUntil = now
+		}
+		item.blockUntil = item.blockUntil.Add(extra)
+		return item
+	})
+}
+
+// Credit moves the time until which calls using the given identifier are
+// delayed back by amount, but never before now. Identifiers without a
+// stored limit or that have been blocked using Block are not affected.
+func (l *Limiter) Credit(identifier string, amount time.Duration) error {
+	return l.adjust(identifier, false, func(now time.Time, item cacheItem) cacheItem {
+		item.blockUntil = item.blockUntil.Add(-amount)
+		if item.blockUntil.Before(now) {
+			item.blockUntil = now
+		}
+		return item
+	})
+}
+
+// adjust updates the limit stored for the given identifier using the given
+// function. Concurrent updates are retried, so no adjustment gets lost.
+func (l *Limiter) adjust(identifier string, create bool, next func(now time.Time, item cacheItem) cacheItem) error {
+	key := l.key(identifier)
+	for {
+		now := l.clock.Now()
+		var previous interface{}
+		item := cacheItem{blockUntil: now, queueLen: 1}
+		value, found, err := getErr(l.cache, key)
+		if err != nil {
+			_, err := l.handleReadError(err)
+			return err
+		}
+		if remaining, ok := l.blocked(value); found && ok {
+			if remaining > 0 {
+				return nil
+			}
+			found, previous = false, replace
+		}
+		if found {
+			stored, ok := decodeCacheItem(value)
+			if ok {
+				previous = value
+				item = stored.rebase(now)
+			} else if err := l.handleInvalidValue(value); err != nil {
+				return err
+			} else {
+				previous = replace
+			}
+		} else if !create && previous == nil {
+			return nil
+		}
+
+		item = next(now, item)
+		item.updatedAt = now
+		// caches might treat non-positive expiries as never expiring
+		expiry := item.blockUntil.Sub(now)
+		if expiry <= 0 {
+			expiry = time.Millisecond
+		}
+		ok, err := update(l.cache, key, previous, item, item.retain(expiry))
+		if err != nil {
+			_, err := l.handleCacheError(err)
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+}
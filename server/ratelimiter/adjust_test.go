@@ -0,0 +1,70 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestLimiter_PenalizeCredit(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := ratelimitertest.NewFakeClock(now)
+	cache := ratelimitertest.NewRecordingCache(clock)
+	limiter, _ := NewLimiter(time.Hour, cache, WithClock(clock))
+
+	limiter.LinearAllow(time.Minute, "limited")
+	limiter.Block("blocked", now.Add(time.Hour), "")
+
+	tests := []struct {
+		name           string
+		run            func() error
+		identifier     string
+		expectedRemain time.Duration
+		expectedFound  bool
+	}{
+		{"penalize unknown", func() error { return limiter.Penalize("unknown", 30*time.Second) }, "unknown", 30 * time.Second, true},
+		{"penalize limited", func() error { return limiter.Penalize("limited", 30*time.Second) }, "limited", 90 * time.Second, true},
+		{"credit limited", func() error { return limiter.Credit("limited", time.Minute) }, "limited", 30 * time.Second, true},
+		{"credit beyond now", func() error { return limiter.Credit("limited", time.Hour) }, "limited", 0, false},
+		{"credit missing", func() error { return limiter.Credit("missing", time.Minute) }, "missing", 0, false},
+		{"penalize blocked", func() error { return limiter.Penalize("blocked", time.Hour) }, "blocked", time.Hour, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.run(); err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			remaining, found := limiter.Peek(test.identifier)
+			if remaining != test.expectedRemain {
+				t.Errorf("Expected %v, got %v", test.expectedRemain, remaining)
+			}
+			if found != test.expectedFound {
+				t.Errorf("Expected %v, got %v", test.expectedFound, found)
+			}
+		})
+	}
+}
+
+func TestLimiter_PenalizeConcurrent(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := ratelimitertest.NewFakeClock(now)
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithClock(clock))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Penalize("concurrent", time.Second)
+		}()
+	}
+	wg.Wait()
+	if remaining, _ := limiter.Peek("concurrent"); remaining != 20*time.Second {
+		t.Errorf("Expected %v, got %v", 20*time.Second, remaining)
+	}
+}
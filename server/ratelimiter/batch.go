@@ -0,0 +1,101 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LinearThrottleBatch linearly throttles all of the given identifiers using
+// the given Throttler and returns the results in the order of the given
+// identifiers. Distinct identifiers are throttled concurrently, while
+// repeated identifiers are throttled one after the other in the order they
+// have been passed.
+func LinearThrottleBatch(ctx context.Context, t Throttler, threshold time.Duration, identifiers []string) []Result {
+	return throttleBatch(identifiers, func(identifier string) <-chan Result {
+		return LinearThrottleCtx(ctx, t, threshold, identifier)
+	})
+}
+
+// ExponentialThrottleBatch works like LinearThrottleBatch but throttles
+// using exponentially increasing thresholds.
+func ExponentialThrottleBatch(ctx context.Context, t Throttler, threshold time.Duration, identifiers []string) []Result {
+	return throttleBatch(identifiers, func(identifier string) <-chan Result {
+		return ExponentialThrottleCtx(ctx, t, threshold, identifier)
+	})
+}
+
+func throttleBatch(identifiers []string, throttle func(string) <-chan Result) []Result {
+	positions := map[string][]int{}
+	var order []string
+	for i, identifier := range identifiers {
+		if _, ok := positions[identifier]; !ok {
+			order = append(order, identifier)
+		}
+		positions[identifier] = append(positions[identifier], i)
+	}
+
+	results := make([]Result, len(identifiers))
+	var wg sync.WaitGroup
+	for _, identifier := range order {
+		wg.Add(1)
+		go func(identifier string) {
+			defer wg.Done()
+			for _, i := range positions[identifier] {
+				results[i] = <-throttle(identifier)
+			}
+		}(identifier)
+	}
+	wg.Wait()
+	return results
+}
+
+// LinearThrottleAll linearly throttles each of the given identifiers using
+// the given Throttler, e.g. for limiting on both an IP and an API key at
+// once. Each identifier is charged independently and all identifiers are
+// throttled concurrently, so the returned channel yields a result once the
+// most restrictive identifier allows the call. In case any identifier
+// returns an error, the result of the first of those in the order passed
+// is returned. Otherwise the returned result is the one with the longest
+// Delay.
+func LinearThrottleAll(ctx context.Context, t Throttler, threshold time.Duration, identifiers ...string) <-chan Result {
+	return throttleAll(func() []Result {
+		return LinearThrottleBatch(ctx, t, threshold, identifiers)
+	})
+}
+
+// ExponentialThrottleAll works like LinearThrottleAll but throttles using
+// exponentially increasing thresholds.
+func ExponentialThrottleAll(ctx context.Context, t Throttler, threshold time.Duration, identifiers ...string) <-chan Result {
+	return throttleAll(func() []Result {
+		return ExponentialThrottleBatch(ctx, t, threshold, identifiers)
+	})
+}
+
+func throttleAll(batch func() []Result) <-chan Result {
+	out := make(chan Result, 1)
+	go func() {
+		defer close(out)
+		out <- mostRestrictive(batch())
+	}()
+	return out
+}
+
+func mostRestrictive(results []Result) Result {
+	var result Result
+	var warning bool
+	for _, r := range results {
+		if r.Error != nil {
+			return r
+		}
+		warning = warning || r.Warning
+		if r.Delay > result.Delay {
+			result = r
+		}
+	}
+	result.Warning = warning
+	return result
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestLinearThrottleBatch(t *testing.T) {
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{})
+	<-limiter.LinearThrottle(time.Millisecond*50, "b")
+
+	results := LinearThrottleBatch(
+		context.Background(), limiter, time.Millisecond*50,
+		[]string{"a", "b", "a", "c"},
+	)
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(results))
+	}
+	for i, delayed := range []bool{false, true, true, false} {
+		if results[i].Error != nil {
+			t.Errorf("Unexpected error %v", results[i].Error)
+		}
+		if (results[i].Delay > 0) != delayed {
+			t.Errorf("Result %d: expected delay %v, got %v", i, delayed, results[i].Delay)
+		}
+	}
+}
+
+func TestLinearThrottleAll(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithClock(clock))
+	<-limiter.LinearThrottle(time.Minute, "ip")
+
+	pending := LinearThrottleAll(context.Background(), limiter, time.Minute, "ip", "key")
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Minute)
+	result := <-pending
+	if result.Error != nil {
+		t.Errorf("Unexpected error %v", result.Error)
+	}
+	if result.Delay != time.Minute {
+		t.Errorf("Expected delay of %v, got %v", time.Minute, result.Delay)
+	}
+	if _, blocked := limiter.Peek("key"); blocked {
+		t.Error("Expected key to be allowed after advancing")
+	}
+	if delay, _ := limiter.Peek("ip"); delay != time.Minute {
+		t.Errorf("Expected ip to be blocked for %v, got %v", time.Minute, delay)
+	}
+
+	<-limiter.LinearThrottle(time.Hour*2, "blocked")
+	result = <-LinearThrottleAll(context.Background(), limiter, time.Hour*2, "other", "blocked")
+	if !errors.Is(result.Error, ErrWouldExceedDeadline) {
+		t.Errorf("Expected %v, got %v", ErrWouldExceedDeadline, result.Error)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CostThrottler is implemented by throttlers that can account for multiple
+// calls at once, like Limiter and TokenBucket. LinearAllowCost performs the
+// same checks and updates as LinearThrottleCost but never blocks.
+type CostThrottler interface {
+	Throttler
+	LinearThrottleCost(threshold time.Duration, identifier string, cost int) <-chan Result
+	LinearAllowCost(threshold time.Duration, identifier string, cost int) (bool, time.Duration, error)
+}
+
+// Batched is a Throttler that trades exactness for throughput by counting
+// calls in memory and passing them on to the wrapped throttler in batches,
+// so only one in `size` calls causes a round trip to the cache. Calls are
+// admitted without being checked until `size` calls have been counted for
+// an identifier. The call completing the batch throttles the whole batch
+// at once using its cost and receives the result. Pending calls are also
+// flushed every `interval` and when closing, which only accounts for them
+// without waiting for the resulting delay. In consequence, up to size - 1
+// calls per identifier can be admitted beyond the limit within each flush
+// window. Exponential throttling is not supported and behaves like linear
+// throttling.
+type Batched struct {
+	next    CostThrottler
+	size    int
+	lock    sync.Mutex
+	pending map[string]*pendingBatch
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+type pendingBatch struct {
+	count     int
+	threshold time.Duration
+}
+
+// NewBatched creates a new Batched wrapping next. An interval that is not
+// positive disables flushing periodically. Sizes smaller than 1 are treated
+// as 1, passing on each call right away.
+func NewBatched(next CostThrottler, size int, interval time.Duration) *Batched {
+	if size < 1 {
+		size = 1
+	}
+	b := &Batched{
+		next:    next,
+		size:    size,
+		pending: map[string]*pendingBatch{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if interval > 0 {
+		go b.loop(interval)
+	} else {
+		close(b.done)
+	}
+	return b
+}
+
+// loop flushes pending calls every interval. Errors are not returned
+// anywhere, but are passed to the wrapped throttler's Observer.
+func (b *Batched) loop(interval time.Duration) {
+	defer close(b.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			b.Flush()
+		}
+	}
+}
+
+// LinearThrottle counts the call, throttling the batch using the wrapped
+// Throttler once it is complete.
+func (b *Batched) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return b.LinearThrottleCtx(context.Background(), threshold, identifier)
+}
+
+// ExponentialThrottle behaves exactly like LinearThrottle.
+func (b *Batched) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return b.LinearThrottleCtx(context.Background(), threshold, identifier)
+}
+
+// LinearThrottleCtx works like LinearThrottle, but stops waiting for the
+// batch to be throttled as soon as the given context is cancelled.
+func (b *Batched) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	b.lock.Lock()
+	batch, ok := b.pending[identifier]
+	if !ok {
+		batch = &pendingBatch{}
+		b.pending[identifier] = batch
+	}
+	batch.count++
+	batch.threshold = threshold
+	if batch.count < b.size {
+		b.lock.Unlock()
+		return passed()
+	}
+	delete(b.pending, identifier)
+	b.lock.Unlock()
+	return withContext(ctx, b.next.LinearThrottleCost(threshold, identifier, batch.count))
+}
+
+// ExponentialThrottleCtx behaves exactly like LinearThrottleCtx.
+func (b *Batched) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return b.LinearThrottleCtx(ctx, threshold, identifier)
+}
+
+// Flush passes on all pending calls to the wrapped Throttler using
+// LinearAllowCost, so their cost is accounted for without waiting for the
+// delay. It returns the first error encountered, e.g. in case the flushed
+// calls exceeded the timeout of the wrapped Throttler.
+func (b *Batched) Flush() error {
+	b.lock.Lock()
+	pending := b.pending
+	b.pending = map[string]*pendingBatch{}
+	b.lock.Unlock()
+	var result error
+	for identifier, batch := range pending {
+		if _, _, err := b.next.LinearAllowCost(batch.threshold, identifier, batch.count); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// Close stops flushing periodically and flushes all pending calls. It then
+// closes the wrapped Throttler in case it implements Closer, returning the
+// first error encountered.
+func (b *Batched) Close(ctx context.Context) error {
+	b.once.Do(func() {
+		close(b.stop)
+	})
+	<-b.done
+	err := b.Flush()
+	if c, ok := b.next.(Closer); ok {
+		if closeErr := c.Close(ctx); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// withContext returns a channel yielding the result received from in, or
+// the context's error in case it is cancelled before.
+func withContext(ctx context.Context, in <-chan Result) <-chan Result {
+	if ctx.Done() == nil {
+		return in
+	}
+	out := make(chan Result, 1)
+	go func() {
+		defer close(out)
+		select {
+		case result := <-in:
+			out <- result
+		case <-ctx.Done():
+			out <- Result{Error: ctx.Err()}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,176 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/memory"
+)
+
+// costRecorder sums up the costs passed for each identifier.
+type costRecorder struct {
+	NoopRatelimiter
+	lock    sync.Mutex
+	costs   map[string]int
+	flushes int
+	err     error
+}
+
+func (c *costRecorder) LinearThrottleCost(threshold time.Duration, identifier string, cost int) <-chan Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.costs == nil {
+		c.costs = map[string]int{}
+	}
+	c.costs[identifier] += cost
+	c.flushes++
+	return passed()
+}
+
+func (c *costRecorder) LinearAllowCost(threshold time.Duration, identifier string, cost int) (bool, time.Duration, error) {
+	<-c.LinearThrottleCost(threshold, identifier, cost)
+	return c.err == nil, 0, c.err
+}
+
+func (c *costRecorder) total(identifier string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.costs[identifier]
+}
+
+func TestBatched(t *testing.T) {
+	tests := []struct {
+		name            string
+		size            int
+		calls           int
+		expectedFlushes int
+	}{
+		{"single batch", 10, 10, 1},
+		{"multiple batches", 10, 30, 3},
+		{"partial batch", 10, 25, 3},
+		{"unbatched", 0, 5, 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := &costRecorder{}
+			batched := NewBatched(recorder, test.size, 0)
+			for i := 0; i < test.calls; i++ {
+				if result := <-batched.LinearThrottle(time.Second, "batched"); result.Error != nil {
+					t.Errorf("Unexpected error %v", result.Error)
+				}
+			}
+			batched.Close(context.Background())
+			if total := recorder.total("batched"); total != test.calls {
+				t.Errorf("Expected %d, got %d", test.calls, total)
+			}
+			if recorder.flushes != test.expectedFlushes {
+				t.Errorf("Expected %d flushes, got %d", test.expectedFlushes, recorder.flushes)
+			}
+		})
+	}
+}
+
+func TestBatched_Interval(t *testing.T) {
+	recorder := &costRecorder{}
+	batched := NewBatched(recorder, 1000, time.Millisecond*10)
+	defer batched.Close(context.Background())
+	for i := 0; i < 5; i++ {
+		<-batched.LinearThrottle(time.Second, "interval")
+	}
+	time.Sleep(time.Millisecond * 50)
+	if total := recorder.total("interval"); total != 5 {
+		t.Errorf("Expected pending calls to be flushed, got %d", total)
+	}
+}
+
+func TestBatched_Flush(t *testing.T) {
+	t.Run("no wait", func(t *testing.T) {
+		limiter, _ := NewLimiter(time.Hour, memory.NewCache(time.Minute))
+		batched := NewBatched(limiter, 10, 0)
+		for i := 0; i < 6; i++ {
+			<-batched.LinearThrottle(time.Minute, "flush")
+			if i%3 == 2 {
+				// flushing returns right away although the second batch
+				// would need to wait for three minutes
+				if err := batched.Flush(); err != nil {
+					t.Errorf("Unexpected error %v", err)
+				}
+			}
+		}
+		if delay, _ := limiter.Peek("flush"); delay <= 5*time.Minute {
+			t.Errorf("Expected both batches to be accounted for, got %v", delay)
+		}
+		batched.Close(context.Background())
+	})
+	t.Run("error", func(t *testing.T) {
+		recorder := &costRecorder{err: errors.New("did not work")}
+		batched := NewBatched(recorder, 10, 0)
+		<-batched.LinearThrottle(time.Second, "flush")
+		if err := batched.Close(context.Background()); err != recorder.err {
+			t.Errorf("Expected %v, got %v", recorder.err, err)
+		}
+	})
+}
+
+func TestBatched_Limit(t *testing.T) {
+	// a token bucket holding 10 tokens admits 10 calls per day, batches of
+	// 4 calls can exceed this by up to 3 calls
+	bucket, _ := NewTokenBucket(10, 0, memory.NewCache(time.Minute))
+	batched := NewBatched(bucket, 4, 0)
+	defer batched.Close(context.Background())
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var admitted int
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if result := <-batched.LinearThrottle(time.Hour*24, "limit"); result.Error == nil {
+				lock.Lock()
+				admitted++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if admitted < 10 || admitted > 10+(100/4)*3 {
+		t.Errorf("Unexpected number of admitted calls %d", admitted)
+	}
+}
+
+func TestBatched_Context(t *testing.T) {
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{})
+	batched := NewBatched(limiter, 2, 0)
+	limiter.LinearAllow(time.Minute, "context")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// the batch keeps waiting, so closing does not wait for it to finish
+	defer batched.Close(ctx)
+	<-batched.LinearThrottleCtx(ctx, time.Minute, "context")
+	if result := <-batched.LinearThrottleCtx(ctx, time.Minute, "context"); result.Error != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, result.Error)
+	}
+}
+
+func BenchmarkBatched(b *testing.B) {
+	for _, size := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("size %d", size), func(b *testing.B) {
+			limiter, _ := NewLimiter(time.Hour, memory.NewCache(time.Minute))
+			batched := NewBatched(limiter, size, time.Millisecond)
+			defer batched.Close(context.Background())
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				<-batched.LinearThrottle(time.Nanosecond, "benchmark")
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrBlocked is returned for calls using an identifier that has been
+// blocked using Block.
+var ErrBlocked = errors.New("ratelimiter: identifier is blocked")
+
+// blockItem is stored in place of a limit for identifiers that have been
+// blocked. It is encoded using a different field than cacheItem, so both
+// can be told apart after being serialized.
+type blockItem struct {
+	until  time.Time
+	reason string
+}
+
+type encodedBlockItem struct {
+	BlockedUntil time.Time `json:"blockedUntil"`
+	Reason       string    `json:"reason,omitempty"`
+}
+
+func (b blockItem) MarshalBinary() ([]byte, error) {
+	return envelope(json.Marshal(encodedBlockItem{
+		BlockedUntil: b.until,
+		Reason:       b.reason,
+	}))
+}
+
+func (b *blockItem) UnmarshalBinary(data []byte) error {
+	var e encodedBlockItem
+	if err := openEnvelope(data, &e); err != nil {
+		return err
+	}
+	if e.BlockedUntil.IsZero() {
+		return errors.New("ratelimiter: value is not a block")
+	}
+	b.until, b.reason = e.BlockedUntil, e.Reason
+	return nil
+}
+
+func decodeBlockItem(value interface{}) (blockItem, bool) {
+	switch v := value.(type) {
+	case blockItem:
+		return v, true
+	case []byte:
+		var item blockItem
+		err := item.UnmarshalBinary(v)
+		return item, err == nil
+	default:
+		return blockItem{}, false
+	}
+}
+
+// BlockedError is returned for calls using an identifier that has been
+// blocked using Block. It carries the key the block is stored at and the
+// reason given when blocking. It matches ErrBlocked when using errors.Is.
+type BlockedError struct {
+	Key    string
+	Until  time.Time
+	Reason string
+}
+
+func (b *BlockedError) Error() string {
+	if b.Reason == "" {
+		return ErrBlocked.Error()
+	}
+	return fmt.Sprintf("%v: %s", ErrBlocked, b.Reason)
+}
+
+// Unwrap returns ErrBlocked.
+func (b *BlockedError) Unwrap() error {
+	return ErrBlocked
+}
+
+func blockedError(key string, value interface{}) error {
+	block, _ := decodeBlockItem(value)
+	return &BlockedError{Key: key, Until: block.until, Reason: block.reason}
+}
+
+// maxBlockReasonLength is the maximum length in bytes of reasons stored
+// using Block.
+const maxBlockReasonLength = 256
+
+// Block makes all calls using the given identifier return a BlockedError
+// until the given time, regardless of the thresholds used. The given reason
+// is stored along with the block, so it can be passed on to the caller,
+// e.g. "abuse report #1234". Reasons longer than 256 bytes are truncated.
+// Any limit stored for the identifier is replaced.
+func (l *Limiter) Block(identifier string, until time.Time, reason string) {
+	if expiry := until.Sub(l.clock.Now()); expiry > 0 {
+		l.cache.Set(l.key(identifier), blockItem{until: until, reason: truncate(reason, maxBlockReasonLength)}, expiry)
+	}
+}
+
+// truncate shortens s to at most n bytes without splitting runes.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// Unblock lifts a block set using Block for the given identifier. Limits
+// stored for the identifier are not affected. It returns an error in case
+// the underlying cache does not implement Deleter.
+func (l *Limiter) Unblock(identifier string) error {
+	d, ok := l.cache.(Deleter)
+	if !ok {
+		return errDeleteUnsupported
+	}
+	key := l.key(identifier)
+	if value, found := l.cache.Get(key); found {
+		if _, ok := decodeBlockItem(value); ok {
+			d.Delete(key)
+		}
+	}
+	return nil
+}
+
+// blocked returns the time the given value blocks calls for in case
+// it has been stored using Block.
+func (l *Limiter) blocked(value interface{}) (time.Duration, bool) {
+	block, ok := decodeBlockItem(value)
+	if !ok {
+		return 0, false
+	}
+	return block.until.Sub(l.clock.Now()), true
+}
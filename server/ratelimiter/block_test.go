@@ -0,0 +1,99 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestLimiter_Block(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := ratelimitertest.NewRecordingCache(clock)
+	limiter, _ := NewLimiter(time.Hour, cache, WithClock(clock))
+
+	limiter.Block("block", clock.Now().Add(time.Hour*2), "")
+	result := <-limiter.LinearThrottle(time.Second, "block")
+	if !errors.Is(result.Error, ErrBlocked) || result.Delay != time.Hour*2 {
+		t.Errorf("Expected %v for %v, got %v", ErrBlocked, time.Hour*2, result)
+	}
+	if remaining, blocked := limiter.Peek("block"); !blocked || remaining != time.Hour*2 {
+		t.Errorf("Expected block of %v, got %v", time.Hour*2, remaining)
+	}
+
+	t.Run("expire", func(t *testing.T) {
+		clock.Advance(time.Hour * 2)
+		if result := <-limiter.LinearThrottle(time.Second, "block"); result != (Result{}) {
+			t.Errorf("Expected empty result, got %v", result)
+		}
+	})
+
+	t.Run("unblock", func(t *testing.T) {
+		limiter.Block("unblock", clock.Now().Add(time.Hour), "")
+		if ok, _, err := limiter.LinearAllow(time.Second, "unblock"); ok || !errors.Is(err, ErrBlocked) {
+			t.Errorf("Expected %v, got %v", ErrBlocked, err)
+		}
+		if err := limiter.Unblock("unblock"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if ok, _, err := limiter.LinearAllow(time.Second, "unblock"); !ok || err != nil {
+			t.Errorf("Expected call to be allowed, got %v", err)
+		}
+		if err := limiter.Unblock("unblock"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if _, limited := limiter.Peek("unblock"); !limited {
+			t.Error("Expected limit not to be removed when unblocking")
+		}
+	})
+
+	t.Run("reason", func(t *testing.T) {
+		limiter.Block("reason", clock.Now().Add(time.Hour), "abuse report #1234")
+		result := <-limiter.LinearThrottle(time.Second, "reason")
+		var blockedErr *BlockedError
+		if !errors.As(result.Error, &blockedErr) {
+			t.Fatalf("Expected BlockedError, got %v", result.Error)
+		}
+		if blockedErr.Reason != "abuse report #1234" || !blockedErr.Until.Equal(clock.Now().Add(time.Hour)) {
+			t.Errorf("Unexpected error %v", blockedErr)
+		}
+		if expected := "ratelimiter: identifier is blocked: abuse report #1234"; result.Error.Error() != expected {
+			t.Errorf("Expected %v, got %v", expected, result.Error.Error())
+		}
+		if snapshot, _ := limiter.Inspect("reason"); snapshot.BlockReason != "abuse report #1234" {
+			t.Errorf("Expected reason in snapshot, got %v", snapshot.BlockReason)
+		}
+	})
+
+	t.Run("long reason", func(t *testing.T) {
+		// runes are not split when truncating
+		limiter.Block("long", clock.Now().Add(time.Hour), strings.Repeat("€", 100))
+		_, _, err := limiter.LinearAllow(time.Second, "long")
+		var blockedErr *BlockedError
+		errors.As(err, &blockedErr)
+		if expected := strings.Repeat("€", 85); blockedErr.Reason != expected {
+			t.Errorf("Expected %v, got %v", expected, blockedErr.Reason)
+		}
+	})
+
+	t.Run("encoded", func(t *testing.T) {
+		data, _ := blockItem{until: clock.Now(), reason: "reason"}.MarshalBinary()
+		if block, ok := decodeBlockItem(data); !ok || block.reason != "reason" {
+			t.Errorf("Expected block to be decoded, got %v", block)
+		}
+		legacy, _ := json.Marshal(map[string]interface{}{"blockedUntil": clock.Now()})
+		if block, ok := decodeBlockItem(legacy); !ok || block.reason != "" {
+			t.Errorf("Expected block without reason to be decoded, got %v", block)
+		}
+		data, _ = cacheItem{blockUntil: clock.Now(), queueLen: 1}.MarshalBinary()
+		if _, ok := decodeBlockItem(data); ok {
+			t.Error("Unexpected decoding of limit as block")
+		}
+	})
+}
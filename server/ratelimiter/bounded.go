@@ -0,0 +1,46 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrBlockTooLong is returned by LinearThrottleBounded and
+// ExponentialThrottleBounded when a call would need to wait for longer than
+// the given maximum.
+var ErrBlockTooLong = errors.New("ratelimiter: call would block for too long")
+
+// LinearThrottleBounded works like LinearThrottle, but calls that would need
+// to wait for longer than maxBlock are rejected immediately using
+// ErrBlockTooLong instead of ErrWouldExceedDeadline, without advancing the
+// limit. maxBlock replaces the timeout of the Limiter and any deadline set
+// using SetDeadline for this call, so it is a hard ceiling for the time the
+// caller will be blocked. A non-positive maxBlock falls back to the
+// Limiter's timeout.
+func (l *Limiter) LinearThrottleBounded(threshold time.Duration, identifier string, maxBlock time.Duration) <-chan Result {
+	return l.throttleBounded(threshold, identifier, false, maxBlock)
+}
+
+// ExponentialThrottleBounded works like ExponentialThrottle, but bounds the
+// time the caller will be blocked like LinearThrottleBounded.
+func (l *Limiter) ExponentialThrottleBounded(threshold time.Duration, identifier string, maxBlock time.Duration) <-chan Result {
+	return l.throttleBounded(threshold, identifier, true, maxBlock)
+}
+
+func (l *Limiter) throttleBounded(threshold time.Duration, identifier string, exponential bool, maxBlock time.Duration) <-chan Result {
+	if maxBlock <= 0 {
+		maxBlock = l.timeout
+	}
+	hashedIdentifier := l.key(identifier)
+	return l.run(context.Background(), hashedIdentifier, l.guard(l.cache, hashedIdentifier, func() (time.Duration, error) {
+		delay, err := l.allow(threshold, hashedIdentifier, exponential, maxBlock)
+		if errors.Is(err, ErrWouldExceedDeadline) {
+			return delay, ErrBlockTooLong
+		}
+		return delay, err
+	}))
+}
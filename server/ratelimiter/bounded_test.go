@@ -0,0 +1,51 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiter_LinearThrottleBounded(t *testing.T) {
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{})
+	<-limiter.LinearThrottle(time.Minute, "bounded")
+
+	tests := []struct {
+		name          string
+		previous      time.Duration
+		maxBlock      time.Duration
+		expectedError error
+	}{
+		{"exceeding maximum", time.Minute, 500 * time.Millisecond, ErrBlockTooLong},
+		{"within maximum", 50 * time.Millisecond, 500 * time.Millisecond, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, _ := NewLimiter(time.Hour, &mockGetSetter{})
+			<-l.LinearThrottle(test.previous, "bounded")
+
+			start := time.Now()
+			result := <-l.LinearThrottleBounded(time.Minute, "bounded", test.maxBlock)
+			if result.Error != test.expectedError {
+				t.Errorf("Expected %v, got %v", test.expectedError, result.Error)
+			}
+			if test.expectedError == nil {
+				if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+					t.Errorf("Expected call to block, returned after %v", elapsed)
+				}
+			} else if errors.Is(result.Error, ErrWouldExceedDeadline) {
+				t.Error("Expected error to be distinguishable from deadline error")
+			}
+		})
+	}
+
+	if result := <-limiter.ExponentialThrottleBounded(time.Minute, "bounded", time.Second); result.Error != ErrBlockTooLong {
+		t.Errorf("Expected %v, got %v", ErrBlockTooLong, result.Error)
+	}
+	if remaining, _ := limiter.Peek("bounded"); remaining > time.Minute {
+		t.Errorf("Expected rejected calls not to advance the limit, got %v", remaining)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrOpen is returned for calls using an identifier whose circuit breaker
+// has been opened because of repeatedly exceeding the timeout.
+var ErrOpen = errors.New("ratelimiter: circuit breaker is open")
+
+// WithCircuitBreaker makes the throttler stop computing limits for
+// identifiers that exceeded the timeout on the given number of consecutive
+// calls. For the duration of the cooldown, calls using such an identifier
+// return ErrOpen right away. After the cooldown, calls are throttled as
+// usual again, but a single call exceeding the timeout opens the breaker
+// again until calls succeed or another cooldown has passed without any
+// calls exceeding the timeout. The number of consecutive failures is
+// stored in the cache next to the limit of each identifier. Passing zero
+// disables the circuit breaker, which is the default.
+func WithCircuitBreaker(failures int, cooldown time.Duration) Option {
+	return func(o *options) {
+		o.breakerFailures = failures
+		o.breakerCooldown = cooldown
+	}
+}
+
+// breakerItem stores the number of consecutive calls that exceeded the
+// timeout and the time until the breaker is open.
+type breakerItem struct {
+	failures  int
+	openUntil time.Time
+}
+
+type encodedBreakerItem struct {
+	Failures  int       `json:"failures"`
+	OpenUntil time.Time `json:"openUntil"`
+}
+
+func (b breakerItem) MarshalBinary() ([]byte, error) {
+	return envelope(json.Marshal(encodedBreakerItem{
+		Failures:  b.failures,
+		OpenUntil: b.openUntil,
+	}))
+}
+
+func (b *breakerItem) UnmarshalBinary(data []byte) error {
+	var e encodedBreakerItem
+	if err := openEnvelope(data, &e); err != nil {
+		return err
+	}
+	b.failures = e.Failures
+	b.openUntil = e.OpenUntil
+	return nil
+}
+
+func decodeBreakerItem(value interface{}) (breakerItem, bool) {
+	switch v := value.(type) {
+	case breakerItem:
+		return v, true
+	case []byte:
+		var item breakerItem
+		err := item.UnmarshalBinary(v)
+		return item, err == nil
+	default:
+		return breakerItem{}, false
+	}
+}
+
+// breakerKey returns the key the circuit breaker for the limit stored at
+// the given key is stored at.
+func breakerKey(key string) string {
+	return key + ":breaker"
+}
+
+// guard wraps the given decision so that it is skipped while the circuit
+// breaker for the given key is open. Errors updating the breaker are
+// skipped so they do not hide the outcome of the decision.
+func (o *options) guard(cache GetSetter, key string, decide func() (time.Duration, error)) func() (time.Duration, error) {
+	if o.breakerFailures == 0 {
+		return decide
+	}
+	return func() (time.Duration, error) {
+		breakerKey := breakerKey(key)
+		now := o.clock.Now()
+		value, found := cache.Get(breakerKey)
+		item, ok := decodeBreakerItem(value)
+		var previous interface{}
+		if found {
+			previous = value
+			if !ok {
+				previous, item = replace, breakerItem{}
+			}
+		}
+		if remaining := item.openUntil.Sub(now); remaining > 0 {
+			return remaining, ErrOpen
+		}
+
+		delay, err := decide()
+		switch {
+		case errors.Is(err, ErrWouldExceedDeadline):
+			next := breakerItem{failures: item.failures + 1}
+			expiry := o.breakerCooldown
+			if next.failures >= o.breakerFailures {
+				// keeping the count just below the limit makes the next
+				// failure after the cooldown open the breaker right away
+				next = breakerItem{
+					failures:  o.breakerFailures - 1,
+					openUntil: now.Add(o.breakerCooldown),
+				}
+				expiry += o.breakerCooldown
+			}
+			update(cache, breakerKey, previous, next, expiry)
+		case err == nil && item.failures > 0:
+			update(cache, breakerKey, previous, breakerItem{}, o.breakerCooldown)
+		}
+		return delay, err
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestWithCircuitBreaker(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter, _ := NewWithOptions(
+		ratelimitertest.NewRecordingCache(clock),
+		WithTimeout(time.Millisecond),
+		WithClock(clock),
+		WithCircuitBreaker(2, time.Minute),
+	)
+
+	expected := []struct {
+		advance       time.Duration
+		expectedError error
+	}{
+		{0, nil},
+		{0, ErrWouldExceedDeadline},
+		{0, ErrWouldExceedDeadline},
+		{0, ErrOpen},
+		{time.Second * 30, ErrOpen},
+		{time.Second * 30, ErrWouldExceedDeadline},
+		{0, ErrOpen},
+		{time.Hour, nil},
+		{0, ErrWouldExceedDeadline},
+		{0, ErrWouldExceedDeadline},
+		{0, ErrOpen},
+	}
+	for i, e := range expected {
+		clock.Advance(e.advance)
+		result := <-limiter.LinearThrottle(time.Minute*10, "breaker")
+		if !errors.Is(result.Error, e.expectedError) {
+			t.Errorf("Call %d: expected %v, got %v", i, e.expectedError, result.Error)
+		}
+	}
+
+	t.Run("allow", func(t *testing.T) {
+		clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		limiter, _ := NewWithOptions(
+			ratelimitertest.NewRecordingCache(clock),
+			WithTimeout(time.Millisecond),
+			WithClock(clock),
+			WithCircuitBreaker(1, time.Minute),
+		)
+		for i, expectedError := range []error{nil, ErrWouldExceedDeadline, ErrOpen} {
+			if _, _, err := limiter.LinearAllow(time.Minute*10, "breaker"); !errors.Is(err, expectedError) {
+				t.Errorf("Call %d: expected %v, got %v", i, expectedError, err)
+			}
+		}
+		if _, _, err := limiter.ExponentialAllowN(time.Minute*10, "breaker", 2); !errors.Is(err, ErrOpen) {
+			t.Errorf("Expected %v, got %v", ErrOpen, err)
+		}
+		if _, err := limiter.Reserve(time.Minute*10, "breaker"); !errors.Is(err, ErrOpen) {
+			t.Errorf("Expected %v, got %v", ErrOpen, err)
+		}
+
+		limiter.Close(context.Background())
+		if _, _, err := limiter.LinearAllow(time.Minute*10, "other"); !errors.Is(err, ErrClosed) {
+			t.Errorf("Expected %v, got %v", ErrClosed, err)
+		}
+	})
+
+	if _, err := NewWithOptions(&mockGetSetter{}, WithCircuitBreaker(-1, time.Second)); err == nil {
+		t.Error("Expected error for negative number of failures")
+	}
+}
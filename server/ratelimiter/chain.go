@@ -0,0 +1,126 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"time"
+)
+
+// Chain returns a Throttler that throttles each call using all of the given
+// throttlers, e.g. for enforcing a short-term and a long-term limit on the
+// same identifier. All throttlers are called concurrently and the returned
+// channel yields a result once all of them allowed the call, so callers
+// wait for the longest delay required. In case any throttler returns an
+// error, the result of the first of those in the order passed is returned.
+//
+// Each throttler advances its own state. Reservations made by other
+// throttlers are not rolled back in case one of the throttlers fails. The
+// Source of the result is the one of the throttler governing it, so
+// throttlers should either use WithNamespace or be wrapped using Named for
+// telling them apart.
+func Chain(throttlers ...Throttler) Throttler {
+	return chain(throttlers)
+}
+
+// Named returns a Throttler that sets the given name as the Source of all
+// results returned by next, e.g. for telling apart the throttlers passed
+// to Chain.
+func Named(name string, next Throttler) Throttler {
+	return &named{name: name, next: next}
+}
+
+type named struct {
+	name string
+	next Throttler
+}
+
+func (n *named) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return n.source(n.next.LinearThrottle(threshold, identifier))
+}
+
+func (n *named) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return n.source(n.next.ExponentialThrottle(threshold, identifier))
+}
+
+func (n *named) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return n.source(LinearThrottleCtx(ctx, n.next, threshold, identifier))
+}
+
+func (n *named) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return n.source(ExponentialThrottleCtx(ctx, n.next, threshold, identifier))
+}
+
+// Close closes the wrapped Throttler in case it implements Closer.
+func (n *named) Close(ctx context.Context) error {
+	if c, ok := n.next.(Closer); ok {
+		return c.Close(ctx)
+	}
+	return nil
+}
+
+func (n *named) source(in <-chan Result) <-chan Result {
+	out := make(chan Result, 1)
+	go func() {
+		defer close(out)
+		result := <-in
+		result.Source = n.name
+		out <- result
+	}()
+	return out
+}
+
+type chain []Throttler
+
+func (c chain) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return c.throttle(func(t Throttler) <-chan Result {
+		return t.LinearThrottle(threshold, identifier)
+	})
+}
+
+func (c chain) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return c.throttle(func(t Throttler) <-chan Result {
+		return t.ExponentialThrottle(threshold, identifier)
+	})
+}
+
+func (c chain) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return c.throttle(func(t Throttler) <-chan Result {
+		return LinearThrottleCtx(ctx, t, threshold, identifier)
+	})
+}
+
+func (c chain) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return c.throttle(func(t Throttler) <-chan Result {
+		return ExponentialThrottleCtx(ctx, t, threshold, identifier)
+	})
+}
+
+// Close closes all chained throttlers implementing Closer, returning the
+// first error encountered.
+func (c chain) Close(ctx context.Context) error {
+	var result error
+	for _, t := range c {
+		if closer, ok := t.(Closer); ok {
+			if err := closer.Close(ctx); err != nil && result == nil {
+				result = err
+			}
+		}
+	}
+	return result
+}
+
+func (c chain) throttle(throttle func(Throttler) <-chan Result) <-chan Result {
+	pending := make([]<-chan Result, len(c))
+	for i, t := range c {
+		pending[i] = throttle(t)
+	}
+	return throttleAll(func() []Result {
+		results := make([]Result, len(pending))
+		for i, p := range pending {
+			results[i] = <-p
+		}
+		return results
+	})
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChain(t *testing.T) {
+	short, _ := NewSlidingWindow(3, time.Hour, &mockGetSetter{})
+	long, _ := NewLimiter(time.Millisecond*10, &mockGetSetter{})
+	throttler := Chain(short, long)
+
+	if result := <-throttler.LinearThrottle(time.Millisecond*50, "chain"); result != (Result{}) {
+		t.Errorf("Expected empty result, got %v", result)
+	}
+	result := <-throttler.LinearThrottle(time.Millisecond*50, "chain")
+	if !errors.Is(result.Error, ErrWouldExceedDeadline) {
+		t.Errorf("Expected %v, got %v", ErrWouldExceedDeadline, result.Error)
+	}
+	if result := <-Chain().LinearThrottle(time.Second, "chain"); result != (Result{}) {
+		t.Errorf("Expected empty result for empty chain, got %v", result)
+	}
+}
+
+func TestChain_LongestDelay(t *testing.T) {
+	short, _ := NewSlidingWindow(1, time.Hour, &mockGetSetter{})
+	long, _ := NewSlidingWindow(5, time.Hour, &mockGetSetter{})
+	throttler := Chain(long, short)
+
+	<-throttler.LinearThrottle(time.Millisecond*30, "chain")
+	result := <-throttler.LinearThrottle(time.Millisecond*30, "chain")
+	if result.Error != nil {
+		t.Errorf("Unexpected error %v", result.Error)
+	}
+	if result.Delay == 0 {
+		t.Error("Expected the delay of the most restrictive throttler")
+	}
+}
+
+func TestChain_Source(t *testing.T) {
+	short, _ := NewSlidingWindow(1, time.Hour, &mockGetSetter{}, WithNamespace("short"))
+	long, _ := NewSlidingWindow(5, time.Hour, &mockGetSetter{})
+	daily, _ := NewLimiter(time.Millisecond*10, &mockGetSetter{})
+
+	throttler := Chain(Named("long", long), short)
+	<-throttler.LinearThrottle(time.Millisecond*30, "source")
+	if result := <-throttler.LinearThrottle(time.Millisecond*30, "source"); result.Source != "short" {
+		t.Errorf("Expected %v, got %v", "short", result.Source)
+	}
+
+	throttler = Chain(short, Named("daily", daily))
+	<-throttler.LinearThrottle(time.Millisecond*50, "rejected")
+	result := <-throttler.LinearThrottle(time.Millisecond*50, "rejected")
+	if !errors.Is(result.Error, ErrWouldExceedDeadline) || result.Source != "daily" {
+		t.Errorf("Expected rejection by %v, got %v", "daily", result)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"time"
+)
+
+// Clock is used by throttlers for reading the current time and waiting.
+// Package ratelimitertest provides an implementation that can be used for
+// deterministically driving time in tests.
+//
+// NewTimer returns a channel receiving the current time once the given
+// duration has passed, and a function for stopping the timer that reports
+// whether it has been stopped before firing, like time.Timer.Stop.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) (<-chan time.Time, func() bool)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(d)
+	return t.C, t.Stop
+}
+
+// clockOf returns the clock used by the given Throttler, falling back to
+// the system's clock for throttlers that do not use one.
+func clockOf(t Throttler) Clock {
+	if c, ok := t.(interface{ getClock() Clock }); ok {
+		return c.getClock()
+	}
+	return realClock{}
+}
+
+// elapsed returns the time that has passed since the given time. In case
+// the clock has been set back in the meantime, no time has passed.
+func elapsed(now, since time.Time) time.Duration {
+	if d := now.Sub(since); d > 0 {
+		return d
+	}
+	return 0
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned for calls made after the throttler has been closed.
+var ErrClosed = errors.New("ratelimiter: throttler is closed")
+
+// Closer is implemented by throttlers that can be shut down gracefully.
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+type drain struct {
+	lock   sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// acquire registers a new inflight call, returning false in case the
+// throttler has already been closed.
+func (d *drain) acquire() bool {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if d.closed {
+		return false
+	}
+	d.wg.Add(1)
+	return true
+}
+
+func (d *drain) release() {
+	d.wg.Done()
+}
+
+// Close stops the throttler from accepting new calls, which will return
+// ErrClosed from now on. It then waits for all inflight calls to send their
+// result or for the given context to be done, whichever happens first.
+func (o *options) Close(ctx context.Context) error {
+	o.drain.lock.Lock()
+	o.drain.closed = true
+	o.drain.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		o.drain.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestLimiter_Close(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithClock(clock))
+
+	<-limiter.LinearThrottle(time.Minute, "close")
+	pending := limiter.LinearThrottle(time.Minute, "close")
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if err := limiter.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	if result := <-limiter.LinearThrottle(time.Minute, "other"); result.Error != ErrClosed {
+		t.Errorf("Expected %v, got %v", ErrClosed, result.Error)
+	}
+
+	clock.Advance(time.Minute)
+	if result := <-pending; result.Error != nil {
+		t.Errorf("Expected nil error, got %v", result.Error)
+	}
+	if err := limiter.Close(context.Background()); err != nil {
+		t.Errorf("Expected nil error, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ConcurrencyLimiter limits the number of operations that are running at
+// the same time for the same identifier instead of the rate at which they
+// are started. Each identifier owns a counter stored in the cache that is
+// incremented when acquiring a slot and decremented when releasing it.
+type ConcurrencyLimiter struct {
+	options
+	max   int
+	ttl   time.Duration
+	cache GetSetter
+}
+
+// ErrTooManyConcurrent is passed to the Observer when a ConcurrencyLimiter
+// rejects a call because all slots are held.
+var ErrTooManyConcurrent = errors.New("ratelimiter: too many concurrent operations")
+
+// Acquire tries to acquire a slot for the given identifier. In case `max`
+// slots are held already, ok is false. Otherwise the returned function
+// must be called once the operation has finished for releasing the slot.
+// Calling it more than once has no further effect. Slots that are never
+// released expire once no slot has been acquired or released for the
+// given identifier for the configured ttl. Releasing a slot after it has
+// expired frees up a slot acquired since, so the ttl should be chosen well
+// above the time operations are expected to take.
+func (c *ConcurrencyLimiter) Acquire(identifier string) (release func(), ok bool) {
+	key := c.hash(identifier)
+	acquired, counted, err := c.change(key, 1)
+	if err == nil && !acquired {
+		err = ErrTooManyConcurrent
+	}
+	if err != nil {
+		c.observe(key, 0, err)
+		return func() {}, false
+	}
+	c.observe(key, 0, nil)
+	if !counted {
+		return func() {}, true
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.change(key, -1)
+		})
+	}, true
+}
+
+// change adds delta to the counter stored at key. It reports whether the
+// change is allowed and whether it has actually been stored, which is not
+// the case when the failure policy allows calls the cache cannot handle.
+func (c *ConcurrencyLimiter) change(key string, delta int) (bool, bool, error) {
+	for {
+		var previous interface{}
+		var item counterItem
+		value, found, err := getErr(c.cache, key)
+		if err != nil {
+			_, err := c.handleReadError(err)
+			return err == nil, false, err
+		}
+		if found {
+			stored, ok := decodeCounterItem(value)
+			if ok {
+				c.hit()
+				previous = value
+				item = stored
+			} else if err := c.handleInvalidValue(value); err != nil {
+				return false, false, err
+			} else {
+				previous = replace
+			}
+		} else {
+			c.miss()
+		}
+
+		next := counterItem{count: item.count + delta}
+		if delta > 0 && item.count >= c.max {
+			return false, false, nil
+		}
+		if next.count < 0 {
+			// the counter has expired while the slot was held
+			return true, false, nil
+		}
+		updated, err := update(c.cache, key, previous, next, c.ttl)
+		if err != nil {
+			_, err := c.handleCacheError(err)
+			return err == nil, false, err
+		}
+		if updated {
+			return true, true, nil
+		}
+	}
+}
+
+// NewConcurrencyLimiter creates a new ConcurrencyLimiter allowing up to
+// `max` operations to run at the same time for the same identifier, using
+// the given cache. Counters expire after `ttl` without any slot being
+// acquired or released.
+func NewConcurrencyLimiter(max int, ttl time.Duration, cache GetSetter, opts ...Option) (*ConcurrencyLimiter, error) {
+	if max < 1 {
+		return nil, errors.New("ratelimiter: maximum number of concurrent operations must be positive")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("ratelimiter: a positive ttl is required")
+	}
+	o, err := newOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ConcurrencyLimiter{
+		options: o,
+		max:     max,
+		ttl:     ttl,
+		cache:   cache,
+	}, nil
+}
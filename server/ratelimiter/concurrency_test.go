@@ -0,0 +1,113 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	observer := &mockObserver{}
+	limiter, err := NewConcurrencyLimiter(2, time.Hour, &mockGetSetter{}, WithObserver(observer))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	releaseA, ok := limiter.Acquire("concurrency")
+	if !ok {
+		t.Error("Expected first slot to be acquired")
+	}
+	releaseB, ok := limiter.Acquire("concurrency")
+	if !ok {
+		t.Error("Expected second slot to be acquired")
+	}
+	if _, ok := limiter.Acquire("concurrency"); ok {
+		t.Error("Expected call to be rejected when all slots are held")
+	}
+	if observer.errors != 1 {
+		t.Errorf("Expected %d errors, got %d", 1, observer.errors)
+	}
+	if _, ok := limiter.Acquire("other"); !ok {
+		t.Error("Expected other identifier to use its own slots")
+	}
+
+	releaseA()
+	// releasing more than once does not free up other slots
+	releaseA()
+	if _, ok := limiter.Acquire("concurrency"); !ok {
+		t.Error("Expected released slot to be acquired again")
+	}
+	if _, ok := limiter.Acquire("concurrency"); ok {
+		t.Error("Expected repeated release to have no effect")
+	}
+	releaseB()
+}
+
+func TestConcurrencyLimiter_Expiry(t *testing.T) {
+	limiter, _ := NewConcurrencyLimiter(1, time.Millisecond*10, &mockGetSetter{})
+	limiter.Acquire("leaked")
+	if _, ok := limiter.Acquire("leaked"); ok {
+		t.Error("Expected call to be rejected while the slot is held")
+	}
+	time.Sleep(time.Millisecond * 20)
+	if _, ok := limiter.Acquire("leaked"); !ok {
+		t.Error("Expected leaked slot to have expired")
+	}
+}
+
+func TestConcurrencyLimiter_Concurrent(t *testing.T) {
+	limiter, _ := NewConcurrencyLimiter(3, time.Hour, &mockGetSetter{})
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var running, peak int
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, ok := limiter.Acquire("concurrent")
+			if !ok {
+				return
+			}
+			defer release()
+			lock.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			lock.Unlock()
+			time.Sleep(time.Millisecond)
+			lock.Lock()
+			running--
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+	if peak > 3 {
+		t.Errorf("Expected at most %d concurrent operations, got %d", 3, peak)
+	}
+}
+
+func TestConcurrencyLimiter_Errors(t *testing.T) {
+	errGet := errors.New("did not work")
+	limiter, _ := NewConcurrencyLimiter(1, time.Hour, &mockUnreachableGetSetter{err: errGet})
+	if _, ok := limiter.Acquire("errors"); ok {
+		t.Error("Expected call to be rejected when the cache is unreachable")
+	}
+	limiter, _ = NewConcurrencyLimiter(1, time.Hour, &mockUnreachableGetSetter{err: errGet}, WithFailurePolicy(FailOpen))
+	release, ok := limiter.Acquire("errors")
+	if !ok {
+		t.Error("Expected call to be allowed when failing open")
+	}
+	release()
+
+	if _, err := NewConcurrencyLimiter(0, time.Hour, &mockGetSetter{}); err == nil {
+		t.Error("Expected error when passing non-positive maximum")
+	}
+	if _, err := NewConcurrencyLimiter(1, 0, &mockGetSetter{}); err == nil {
+		t.Error("Expected error when passing non-positive ttl")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Kind describes the algorithm a throttler uses.
+type Kind string
+
+// The kinds of throttlers provided by this package.
+const (
+	KindLimiter       Kind = "limiter"
+	KindTokenBucket   Kind = "token-bucket"
+	KindSlidingWindow Kind = "sliding-window"
+	KindLeakyBucket   Kind = "leaky-bucket"
+	KindFixedWindow   Kind = "fixed-window"
+)
+
+// Config describes the configuration of a throttler. As thresholds are
+// passed per call, Limit is the number of calls allowed per threshold.
+type Config struct {
+	Kind    Kind
+	Timeout time.Duration
+	Limit   int
+}
+
+// Configurable is implemented by throttlers that can report their
+// configuration, e.g. for setting rate limit response headers. Throttlers
+// are not required to implement it, so callers should use a type assertion.
+type Configurable interface {
+	Config() Config
+}
+
+// Config returns the Limiter's configuration. A Limiter allows a single
+// call per threshold.
+func (l *Limiter) Config() Config {
+	return Config{Kind: KindLimiter, Timeout: l.timeout, Limit: 1}
+}
+
+// Config returns the TokenBucket's configuration, using its capacity as
+// the limit.
+func (t *TokenBucket) Config() Config {
+	return Config{Kind: KindTokenBucket, Timeout: t.timeout, Limit: t.capacity}
+}
+
+// Config returns the SlidingWindow's configuration.
+func (s *SlidingWindow) Config() Config {
+	return Config{Kind: KindSlidingWindow, Timeout: s.timeout, Limit: s.limit}
+}
+
+// Config returns the LeakyBucket's configuration, using its capacity as
+// the limit.
+func (b *LeakyBucket) Config() Config {
+	return Config{Kind: KindLeakyBucket, Timeout: b.timeout, Limit: b.capacity}
+}
+
+// Config returns the FixedWindow's configuration.
+func (f *FixedWindow) Config() Config {
+	return Config{Kind: KindFixedWindow, Timeout: f.timeout, Limit: f.limit}
+}
+
+// Policy describes the quota a throttler enforces when using a given
+// threshold, i.e. the number of calls allowed within Window.
+type Policy struct {
+	Kind   Kind
+	Quota  int
+	Window time.Duration
+}
+
+// String formats the policy as used in RateLimit-Policy headers as
+// described in draft-ietf-httpapi-ratelimit-headers, e.g. "10;w=1" for a
+// quota of 10 calls per second. The window is rounded up to full seconds.
+func (p Policy) String() string {
+	seconds := int64(math.Ceil(p.Window.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return fmt.Sprintf("%d;w=%d", p.Quota, seconds)
+}
+
+// PolicyDescriber is implemented by throttlers that can describe the policy
+// they enforce. As thresholds are passed per call, the threshold in use
+// needs to be passed. Throttlers are not required to implement it, so
+// callers should use a type assertion.
+type PolicyDescriber interface {
+	Policy(threshold time.Duration) Policy
+}
+
+// Policy returns the policy of a Limiter, allowing a single call per
+// threshold.
+func (l *Limiter) Policy(threshold time.Duration) Policy {
+	return Policy{Kind: KindLimiter, Quota: 1, Window: threshold}
+}
+
+// Policy returns the policy of a TokenBucket. A full bucket is refilled
+// within capacity times threshold.
+func (t *TokenBucket) Policy(threshold time.Duration) Policy {
+	return Policy{Kind: KindTokenBucket, Quota: t.capacity, Window: time.Duration(t.capacity) * threshold}
+}
+
+// Policy returns the policy of a SlidingWindow.
+func (s *SlidingWindow) Policy(threshold time.Duration) Policy {
+	return Policy{Kind: KindSlidingWindow, Quota: s.limit, Window: threshold}
+}
+
+// Policy returns the policy of a LeakyBucket. A full bucket drains within
+// capacity times threshold.
+func (b *LeakyBucket) Policy(threshold time.Duration) Policy {
+	return Policy{Kind: KindLeakyBucket, Quota: b.capacity, Window: time.Duration(b.capacity) * threshold}
+}
+
+// Policy returns the policy of a FixedWindow.
+func (f *FixedWindow) Policy(threshold time.Duration) Policy {
+	return Policy{Kind: KindFixedWindow, Quota: f.limit, Window: threshold}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigurable(t *testing.T) {
+	bucket, _ := NewTokenBucket(3, time.Second, &mockGetSetter{})
+	sliding, _ := NewSlidingWindow(4, time.Second, &mockGetSetter{})
+	leaky, _ := NewLeakyBucket(5, time.Second, &mockGetSetter{})
+	fixed, _ := NewFixedWindow(6, time.Second, &mockGetSetter{})
+	tests := []struct {
+		name     string
+		t        Throttler
+		expected Config
+	}{
+		{"limiter", New(time.Second, &mockGetSetter{}), Config{KindLimiter, time.Second, 1}},
+		{"token bucket", bucket, Config{KindTokenBucket, time.Second, 3}},
+		{"sliding window", sliding, Config{KindSlidingWindow, time.Second, 4}},
+		{"leaky bucket", leaky, Config{KindLeakyBucket, time.Second, 5}},
+		{"fixed window", fixed, Config{KindFixedWindow, time.Second, 6}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, ok := test.t.(Configurable)
+			if !ok {
+				t.Fatal("Expected throttler to implement Configurable")
+			}
+			if config := c.Config(); config != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, config)
+			}
+		})
+	}
+	if _, ok := NewNoopRateLimiter().(Configurable); ok {
+		t.Error("Unexpected implementation of Configurable")
+	}
+}
+
+func TestPolicyDescriber(t *testing.T) {
+	bucket, _ := NewTokenBucket(3, time.Second, &mockGetSetter{})
+	sliding, _ := NewSlidingWindow(4, time.Second, &mockGetSetter{})
+	leaky, _ := NewLeakyBucket(5, time.Second, &mockGetSetter{})
+	fixed, _ := NewFixedWindow(6, time.Second, &mockGetSetter{})
+	tests := []struct {
+		name           string
+		t              Throttler
+		expected       Policy
+		expectedHeader string
+	}{
+		{"limiter", New(time.Second, &mockGetSetter{}), Policy{KindLimiter, 1, time.Minute}, "1;w=60"},
+		{"token bucket", bucket, Policy{KindTokenBucket, 3, 3 * time.Minute}, "3;w=180"},
+		{"sliding window", sliding, Policy{KindSlidingWindow, 4, time.Minute}, "4;w=60"},
+		{"leaky bucket", leaky, Policy{KindLeakyBucket, 5, 5 * time.Minute}, "5;w=300"},
+		{"fixed window", fixed, Policy{KindFixedWindow, 6, time.Minute}, "6;w=60"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, ok := test.t.(PolicyDescriber)
+			if !ok {
+				t.Fatal("Expected throttler to implement PolicyDescriber")
+			}
+			policy := d.Policy(time.Minute)
+			if policy != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, policy)
+			}
+			if header := policy.String(); header != test.expectedHeader {
+				t.Errorf("Expected %v, got %v", test.expectedHeader, header)
+			}
+		})
+	}
+	if header := (Policy{Quota: 10, Window: time.Millisecond}).String(); header != "10;w=1" {
+		t.Errorf("Expected %v, got %v", "10;w=1", header)
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"time"
+)
+
+// deadlineRetention is the minimum time limits carrying a deadline set using
+// SetDeadline are kept for after their last update.
+const deadlineRetention = 30 * 24 * time.Hour
+
+// SetDeadline stores a deadline for the given identifier that is used
+// instead of the Limiter's timeout, e.g. for granting some identifiers a
+// higher tolerance. As the deadline is stored alongside the limit, it
+// applies to all instances sharing the cache and survives restarts. It is
+// kept for at least 30 days after the last call using the identifier.
+// Timeouts passed using LinearThrottleWithTimeout take precedence. Passing
+// a non-positive deadline removes a stored deadline. Identifiers that have
+// been blocked using Block are not affected.
+func (l *Limiter) SetDeadline(identifier string, d time.Duration) error {
+	if d < 0 {
+		d = 0
+	}
+	return l.adjust(identifier, d > 0, func(now time.Time, item cacheItem) cacheItem {
+		item.deadline = d
+		return item
+	})
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestLimiter_SetDeadline(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := ratelimitertest.NewFakeClock(now)
+	cache := ratelimitertest.NewRecordingCache(clock)
+	limiter, _ := NewLimiter(time.Minute, cache, WithClock(clock))
+
+	if err := limiter.SetDeadline("vip", time.Hour); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	tests := []struct {
+		identifier    string
+		calls         int
+		expectedDelay time.Duration
+	}{
+		{"vip", 13, time.Hour},
+		{"default", 1, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.identifier, func(t *testing.T) {
+			var delay time.Duration
+			for i := 0; i < test.calls; i++ {
+				var err error
+				if _, delay, err = limiter.LinearAllow(5*time.Minute, test.identifier); err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+			}
+			if delay != test.expectedDelay {
+				t.Errorf("Expected %v, got %v", test.expectedDelay, delay)
+			}
+			if _, _, err := limiter.LinearAllow(5*time.Minute, test.identifier); !errors.Is(err, ErrWouldExceedDeadline) {
+				t.Errorf("Expected %v, got %v", ErrWouldExceedDeadline, err)
+			}
+		})
+	}
+
+	t.Run("persisted", func(t *testing.T) {
+		clock.Advance(2 * time.Hour)
+		other, _ := NewLimiter(time.Minute, cache, WithClock(clock), WithSalt(limiter.salt))
+		<-other.LinearThrottle(5*time.Minute, "vip")
+		if _, delay, err := other.LinearAllow(5*time.Minute, "vip"); err != nil || delay != 5*time.Minute {
+			t.Errorf("Expected stored deadline to be used, got %v and %v", delay, err)
+		}
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		if err := limiter.SetDeadline("vip", 0); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if _, _, err := limiter.LinearAllow(5*time.Minute, "vip"); !errors.Is(err, ErrWouldExceedDeadline) {
+			t.Errorf("Expected %v, got %v", ErrWouldExceedDeadline, err)
+		}
+	})
+}
@@ -0,0 +1,242 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// All values stored by throttlers implement encoding.BinaryMarshaler so
+// caches that need to serialize values can do so. Such caches are expected
+// to return the encoded value as a []byte when calling Get.
+//
+// Encoded values are prefixed with a version byte, so instances using
+// different formats can share a cache. Values of unknown versions are
+// treated as if they were not found, while JSON values stored before
+// versions were introduced are still read.
+
+// encodingVersion is the version prefixed to encoded values. Versions are
+// kept below 0x20 so they cannot be mistaken for the start of JSON.
+const encodingVersion = 1
+
+var errUnknownVersion = errors.New("ratelimiter: unknown encoding version")
+
+func envelope(payload []byte, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{encodingVersion}, payload...), nil
+}
+
+func openEnvelope(data []byte, v interface{}) error {
+	switch {
+	case len(data) > 0 && data[0] == encodingVersion:
+		data = data[1:]
+	case unknownVersion(data):
+		return errUnknownVersion
+	}
+	return json.Unmarshal(data, v)
+}
+
+func unknownVersion(data []byte) bool {
+	return len(data) > 0 && data[0] < 0x20 && data[0] != encodingVersion
+}
+
+type encodedCacheItem struct {
+	BlockUntil time.Time     `json:"blockUntil"`
+	QueueLen   int64         `json:"queueLen"`
+	UpdatedAt  time.Time     `json:"updatedAt"`
+	Deadline   time.Duration `json:"deadline,omitempty"`
+	Burst      int64         `json:"burst,omitempty"`
+}
+
+func (c cacheItem) MarshalBinary() ([]byte, error) {
+	return envelope(json.Marshal(encodedCacheItem{
+		BlockUntil: c.blockUntil,
+		QueueLen:   c.queueLen,
+		UpdatedAt:  c.updatedAt,
+		Deadline:   c.deadline,
+		Burst:      c.burst,
+	}))
+}
+
+func (c *cacheItem) UnmarshalBinary(data []byte) error {
+	var e encodedCacheItem
+	if err := openEnvelope(data, &e); err != nil {
+		return err
+	}
+	c.blockUntil, c.queueLen, c.updatedAt, c.deadline, c.burst = e.BlockUntil, e.QueueLen, e.UpdatedAt, e.Deadline, e.Burst
+	return nil
+}
+
+// decodeCacheItem also accepts plain timestamps given as a time.Time or as
+// nanoseconds since the Unix epoch, so limits can be written by other
+// systems sharing the cache, e.g. Lua scripts in Redis. Nanoseconds can be
+// given as int64, as float64 like when decoded from JSON, or as a []byte
+// holding the number in decimal notation.
+func decodeCacheItem(value interface{}) (cacheItem, bool) {
+	switch v := value.(type) {
+	case cacheItem:
+		return v, true
+	case []byte:
+		var item cacheItem
+		if err := item.UnmarshalBinary(v); err == nil {
+			return item, true
+		}
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return timestampItem(time.Unix(0, n)), true
+		}
+		if f, err := strconv.ParseFloat(string(v), 64); err == nil {
+			return timestampItem(time.Unix(0, int64(f))), true
+		}
+		return cacheItem{}, false
+	case time.Time:
+		return timestampItem(v), true
+	case int64:
+		return timestampItem(time.Unix(0, v)), true
+	case float64:
+		return timestampItem(time.Unix(0, int64(v))), true
+	default:
+		return cacheItem{}, false
+	}
+}
+
+func timestampItem(blockUntil time.Time) cacheItem {
+	return cacheItem{blockUntil: blockUntil, queueLen: 1}
+}
+
+type encodedBucketItem struct {
+	Tokens     float64   `json:"tokens"`
+	LastRefill time.Time `json:"lastRefill"`
+}
+
+func (b bucketItem) MarshalBinary() ([]byte, error) {
+	return envelope(json.Marshal(encodedBucketItem{
+		Tokens:     b.tokens,
+		LastRefill: b.lastRefill,
+	}))
+}
+
+func (b *bucketItem) UnmarshalBinary(data []byte) error {
+	var e encodedBucketItem
+	if err := openEnvelope(data, &e); err != nil {
+		return err
+	}
+	b.tokens, b.lastRefill = e.Tokens, e.LastRefill
+	return nil
+}
+
+func decodeBucketItem(value interface{}) (bucketItem, bool) {
+	switch v := value.(type) {
+	case bucketItem:
+		return v, true
+	case []byte:
+		var item bucketItem
+		err := item.UnmarshalBinary(v)
+		return item, err == nil
+	default:
+		return bucketItem{}, false
+	}
+}
+
+type encodedWindowItem struct {
+	Calls []time.Time `json:"calls"`
+}
+
+func (w *windowItem) MarshalBinary() ([]byte, error) {
+	return envelope(json.Marshal(encodedWindowItem{
+		Calls: w.calls,
+	}))
+}
+
+func (w *windowItem) UnmarshalBinary(data []byte) error {
+	var e encodedWindowItem
+	if err := openEnvelope(data, &e); err != nil {
+		return err
+	}
+	w.calls = e.Calls
+	return nil
+}
+
+func decodeWindowItem(value interface{}) (*windowItem, bool) {
+	switch v := value.(type) {
+	case *windowItem:
+		return v, true
+	case []byte:
+		item := &windowItem{}
+		err := item.UnmarshalBinary(v)
+		return item, err == nil
+	default:
+		return nil, false
+	}
+}
+
+type encodedLeakyItem struct {
+	Level    float64   `json:"level"`
+	LastLeak time.Time `json:"lastLeak"`
+}
+
+func (l leakyItem) MarshalBinary() ([]byte, error) {
+	return envelope(json.Marshal(encodedLeakyItem{
+		Level:    l.level,
+		LastLeak: l.lastLeak,
+	}))
+}
+
+func (l *leakyItem) UnmarshalBinary(data []byte) error {
+	var e encodedLeakyItem
+	if err := openEnvelope(data, &e); err != nil {
+		return err
+	}
+	l.level, l.lastLeak = e.Level, e.LastLeak
+	return nil
+}
+
+func decodeLeakyItem(value interface{}) (leakyItem, bool) {
+	switch v := value.(type) {
+	case leakyItem:
+		return v, true
+	case []byte:
+		var item leakyItem
+		err := item.UnmarshalBinary(v)
+		return item, err == nil
+	default:
+		return leakyItem{}, false
+	}
+}
+
+type encodedCounterItem struct {
+	Count int `json:"count"`
+}
+
+func (c counterItem) MarshalBinary() ([]byte, error) {
+	return envelope(json.Marshal(encodedCounterItem{
+		Count: c.count,
+	}))
+}
+
+func (c *counterItem) UnmarshalBinary(data []byte) error {
+	var e encodedCounterItem
+	if err := openEnvelope(data, &e); err != nil {
+		return err
+	}
+	c.count = e.Count
+	return nil
+}
+
+func decodeCounterItem(value interface{}) (counterItem, bool) {
+	switch v := value.(type) {
+	case counterItem:
+		return v, true
+	case []byte:
+		var item counterItem
+		err := item.UnmarshalBinary(v)
+		return item, err == nil
+	default:
+		return counterItem{}, false
+	}
+}
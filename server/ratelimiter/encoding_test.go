@@ -0,0 +1,129 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestEncoding(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("cacheItem", func(t *testing.T) {
+		item := cacheItem{blockUntil: now, queueLen: 12, deadline: time.Hour, burst: 3}
+		data, _ := item.MarshalBinary()
+		result, ok := decodeCacheItem(data)
+		if !ok || !reflect.DeepEqual(item, result) {
+			t.Errorf("Expected %v, got %v", item, result)
+		}
+		if _, ok := decodeCacheItem([]byte("zomfg")); ok {
+			t.Error("Expected invalid data to fail decoding")
+		}
+	})
+	t.Run("bucketItem", func(t *testing.T) {
+		item := bucketItem{tokens: -1.5, lastRefill: now}
+		data, _ := item.MarshalBinary()
+		result, ok := decodeBucketItem(data)
+		if !ok || !reflect.DeepEqual(item, result) {
+			t.Errorf("Expected %v, got %v", item, result)
+		}
+		if _, ok := decodeBucketItem(item); !ok {
+			t.Error("Expected native value to be decoded")
+		}
+	})
+	t.Run("windowItem", func(t *testing.T) {
+		item := &windowItem{calls: []time.Time{now, now.Add(time.Second)}}
+		data, _ := item.MarshalBinary()
+		result, ok := decodeWindowItem(data)
+		if !ok || !reflect.DeepEqual(item, result) {
+			t.Errorf("Expected %v, got %v", item, result)
+		}
+		if _, ok := decodeWindowItem(12); ok {
+			t.Error("Expected unknown type to fail decoding")
+		}
+	})
+	t.Run("counterItem", func(t *testing.T) {
+		item := counterItem{count: 7}
+		data, _ := item.MarshalBinary()
+		result, ok := decodeCounterItem(data)
+		if !ok || !reflect.DeepEqual(item, result) {
+			t.Errorf("Expected %v, got %v", item, result)
+		}
+		if _, ok := decodeCounterItem("7"); ok {
+			t.Error("Expected unknown type to fail decoding")
+		}
+	})
+}
+
+func TestEncoding_Versions(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	item := cacheItem{blockUntil: now, queueLen: 2}
+
+	t.Run("current", func(t *testing.T) {
+		data, _ := item.MarshalBinary()
+		if data[0] != encodingVersion {
+			t.Errorf("Expected value to be prefixed with version %d, got %d", encodingVersion, data[0])
+		}
+	})
+	t.Run("unversioned", func(t *testing.T) {
+		data := []byte(`{"blockUntil":"2020-01-01T00:00:00Z","queueLen":2}`)
+		if result, ok := decodeCacheItem(data); !ok || !reflect.DeepEqual(item, result) {
+			t.Errorf("Expected %v, got %v", item, result)
+		}
+	})
+	t.Run("unknown", func(t *testing.T) {
+		data, _ := item.MarshalBinary()
+		data[0] = encodingVersion + 1
+		if _, ok := decodeCacheItem(data); ok {
+			t.Error("Expected unknown version to fail decoding")
+		}
+		cache := &mockGetSetter{}
+		cache.Set("key", data, time.Minute)
+		limiter, _ := NewLimiter(time.Hour, cache, WithHasher(func([]byte) string { return "key" }))
+		if result := <-limiter.LinearThrottle(time.Minute, "unknown"); result.Error != nil {
+			t.Errorf("Unexpected error %v", result.Error)
+		}
+	})
+}
+
+func TestLimiter_Timestamps(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := ratelimitertest.NewFakeClock(now)
+	blockUntil := now.Add(time.Minute)
+
+	tests := []struct {
+		name          string
+		value         interface{}
+		expectedDelay time.Duration
+		expectedError error
+	}{
+		{"time", blockUntil, time.Minute, nil},
+		{"int64", blockUntil.UnixNano(), time.Minute, nil},
+		{"float64", float64(blockUntil.UnixNano()), time.Minute, nil},
+		{"bytes", []byte(strconv.FormatInt(blockUntil.UnixNano(), 10)), time.Minute, nil},
+		{"float bytes", []byte("1.5778368600e+18"), time.Minute, nil},
+		{"string", "zomfg", 0, ErrInvalidCache},
+		{"int", 12, 0, ErrInvalidCache},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := ratelimitertest.NewRecordingCache(clock)
+			limiter, _ := NewLimiter(time.Hour, cache, WithClock(clock))
+			cache.Set(limiter.Key("id"), test.value, time.Hour)
+
+			_, delay, err := limiter.LinearAllow(time.Second, "id")
+			if err != test.expectedError {
+				t.Errorf("Expected %v, got %v", test.expectedError, err)
+			}
+			if delay != test.expectedDelay {
+				t.Errorf("Expected %v, got %v", test.expectedDelay, delay)
+			}
+		})
+	}
+}
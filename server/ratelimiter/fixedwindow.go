@@ -0,0 +1,151 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// FixedWindow is a Throttler that allows up to `limit` calls for the same
+// identifier within windows of `threshold` that are aligned to the Unix
+// epoch, e.g. resetting on the full hour when using a threshold of one
+// hour. Calls exceeding the limit are delayed until the start of the next
+// window that has calls left.
+type FixedWindow struct {
+	options
+	limit int
+	cache GetSetter
+}
+
+// counterItem stores the number of calls admitted within a window.
+type counterItem struct {
+	count int
+}
+
+// LinearThrottle returns a channel that blocks until the current window
+// of length threshold has calls left.
+func (f *FixedWindow) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return f.LinearThrottleCtx(context.Background(), threshold, identifier)
+}
+
+// ExponentialThrottle behaves exactly like LinearThrottle as a fixed
+// window has no notion of a queue that could grow exponentially.
+func (f *FixedWindow) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return f.LinearThrottleCtx(context.Background(), threshold, identifier)
+}
+
+// LinearThrottleCtx works like LinearThrottle, but stops waiting as soon as
+// the given context is cancelled.
+func (f *FixedWindow) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return f.throttle(ctx, threshold, identifier)
+}
+
+// ExponentialThrottleCtx behaves exactly like LinearThrottleCtx.
+func (f *FixedWindow) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return f.throttle(ctx, threshold, identifier)
+}
+
+func (f *FixedWindow) throttle(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	hashedIdentifier := f.hash(identifier)
+	var d decision
+	return f.runWith(ctx, hashedIdentifier, &d, f.guard(f.cache, hashedIdentifier, func() (time.Duration, error) {
+		return f.allow(threshold, hashedIdentifier, &d.used)
+	}))
+}
+
+func (f *FixedWindow) allow(threshold time.Duration, hashedIdentifier string, used *float64) (time.Duration, error) {
+	if threshold <= 0 {
+		return 0, ErrInvalidThreshold
+	}
+	now := f.clock.Now()
+	// windows that have been used up are skipped until the first window
+	// that has calls left, which the call is admitted at
+	for start := windowStart(now, threshold); ; {
+		delay := start.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+		if delay > f.timeout {
+			return delay, deadlineExceeded(hashedIdentifier, delay, f.timeout)
+		}
+
+		key := f.windowKey(hashedIdentifier, start, threshold)
+		var previous interface{}
+		var item counterItem
+		value, found, err := getErr(f.cache, key)
+		if err != nil {
+			return f.handleReadError(err)
+		}
+		if found {
+			stored, ok := decodeCounterItem(value)
+			if ok {
+				f.hit()
+				previous = value
+				item = stored
+			} else if err := f.handleInvalidValue(value); err != nil {
+				return 0, err
+			} else {
+				previous = replace
+			}
+		} else {
+			f.miss()
+		}
+		if item.count >= f.limit {
+			start = start.Add(threshold)
+			continue
+		}
+
+		next := counterItem{count: item.count + 1}
+		ok, err := update(f.cache, key, previous, next, start.Add(threshold).Sub(now))
+		if err != nil {
+			return f.handleCacheError(err)
+		}
+		if ok {
+			reportUsage(used, float64(next.count)/float64(f.limit))
+			return delay, nil
+		}
+		// another caller updated the window in the meantime, so the
+		// window needs to be checked again
+	}
+}
+
+// windowID identifies the window of length threshold starting at the
+// given time by the number of windows since the Unix epoch.
+func (f *FixedWindow) windowID(start time.Time, threshold time.Duration) int64 {
+	return start.UnixNano() / int64(threshold)
+}
+
+// windowKey returns the key the counter for the window of length threshold
+// starting at the given time is stored at.
+func (f *FixedWindow) windowKey(hashedIdentifier string, start time.Time, threshold time.Duration) string {
+	return fmt.Sprintf("%s:%d", hashedIdentifier, f.windowID(start, threshold))
+}
+
+// windowStart returns the start of the window of the given threshold that
+// contains t. Unlike time.Truncate, windows are aligned to the Unix epoch
+// so they match the IDs returned by windowID for any threshold.
+func windowStart(t time.Time, threshold time.Duration) time.Time {
+	return time.Unix(0, t.UnixNano()/int64(threshold)*int64(threshold))
+}
+
+// NewFixedWindow creates a new FixedWindow. `limit` defines the number of
+// calls that can be made for the same identifier within each window of the
+// threshold passed when throttling and must be positive.
+func NewFixedWindow(limit int, timeout time.Duration, cache GetSetter, opts ...Option) (*FixedWindow, error) {
+	if limit < 1 {
+		return nil, errors.New("ratelimiter: limit must be positive")
+	}
+	o, err := newOptions(append([]Option{WithTimeout(timeout)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &FixedWindow{
+		options: o,
+		limit:   limit,
+		cache:   cache,
+	}, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestFixedWindow_allow(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 59, 30, 0, time.UTC))
+	window, _ := NewFixedWindow(2, time.Hour, &mockGetSetter{}, WithClock(clock))
+	key := window.hash("fixed")
+
+	expected := []struct {
+		advance time.Duration
+		delay   time.Duration
+		err     error
+	}{
+		{0, 0, nil},
+		{0, 0, nil},
+		{0, time.Second * 30, nil},
+		{time.Second * 10, time.Second * 20, nil},
+		{0, time.Hour + time.Second*20, ErrWouldExceedDeadline},
+		{time.Second * 20, time.Hour, nil},
+		{time.Hour, 0, nil},
+	}
+	for i, e := range expected {
+		clock.Advance(e.advance)
+		delay, err := window.allow(time.Hour, key, nil)
+		if delay != e.delay || !errors.Is(err, e.err) {
+			t.Errorf("Call %d: expected %v, %v, got %v, %v", i, e.delay, e.err, delay, err)
+		}
+	}
+}
+
+func TestFixedWindow_Week(t *testing.T) {
+	// 2020-01-01 is a Wednesday, windows of a week are aligned to the Unix
+	// epoch and start on Thursdays
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	window, _ := NewFixedWindow(1, time.Hour*24*7, &mockGetSetter{}, WithClock(clock))
+	key := window.hash("week")
+	week := time.Hour * 24 * 7
+
+	if delay, err := window.allow(week, key, nil); delay != 0 || err != nil {
+		t.Errorf("Expected %v, %v, got %v, %v", 0, nil, delay, err)
+	}
+	if delay, err := window.allow(week, key, nil); delay != time.Hour*12 || err != nil {
+		t.Errorf("Expected %v, %v, got %v, %v", time.Hour*12, nil, delay, err)
+	}
+}
+
+func TestFixedWindow_windowID(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		opts      []Option
+		threshold time.Duration
+		expected  int64
+	}{
+		{"second", nil, time.Second, start.Unix()},
+		{"hour", nil, time.Hour, start.Unix() / 3600},
+		{"millisecond", nil, time.Millisecond, start.UnixNano() / int64(time.Millisecond)},
+		{"precision", []Option{WithTimePrecision(time.Second)}, time.Millisecond * 100, start.UnixNano() / int64(time.Millisecond*100)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			window, _ := NewFixedWindow(1, time.Second, &mockGetSetter{}, test.opts...)
+			if id := window.windowID(start, test.threshold); id != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, id)
+			}
+		})
+	}
+}
+
+func TestFixedWindow_TimePrecision(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	window, _ := NewFixedWindow(1, time.Hour, &mockGetSetter{}, WithClock(clock), WithTimePrecision(time.Second))
+	key := window.hash("precision")
+	if delay, err := window.allow(time.Millisecond*100, key, nil); delay != 0 || err != nil {
+		t.Errorf("Expected %v, %v, got %v, %v", 0, nil, delay, err)
+	}
+	// windows shorter than the precision must not share their counter
+	clock.Advance(time.Millisecond * 100)
+	if delay, err := window.allow(time.Millisecond*100, key, nil); delay != 0 || err != nil {
+		t.Errorf("Expected %v, %v, got %v, %v", 0, nil, delay, err)
+	}
+}
+
+func TestFixedWindow_LinearThrottle(t *testing.T) {
+	window, _ := NewFixedWindow(1, time.Hour, &mockGetSetter{})
+	for i := 0; i < 2; i++ {
+		if result := <-window.LinearThrottle(time.Millisecond*20, "fixed"); result.Error != nil {
+			t.Errorf("Unexpected error %v", result.Error)
+		}
+	}
+	if result := <-window.LinearThrottle(time.Hour*2, "other"); result.Error != nil || result.Delay != 0 {
+		t.Errorf("Unexpected result %v", result)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"time"
+)
+
+// globalKey is the identifier the global limit of GlobalCap is stored for.
+// It contains a NUL byte so it does not collide with identifiers in use.
+const globalKey = "\x00global"
+
+// GlobalSource is the Source of results governed by the global limit of
+// GlobalCap.
+const GlobalSource = "global"
+
+// GlobalCap returns a Throttler that, in addition to the per-identifier
+// limit enforced by next, limits all calls to one per globalThreshold, e.g.
+// for protecting a shared downstream resource. Each call first requests a
+// slot for the global limit and then for its identifier, both using next.
+// The returned channel yields a result once both limits allow the call, so
+// callers wait for the longer of both delays. In case both fail, the error
+// of the global limit is returned. Results governed by the global limit
+// use GlobalSource as their Source. The global limit always uses linear
+// throttling. As with Chain, a slot reserved for one of the limits is not
+// returned when the other one rejects the call.
+func GlobalCap(next Throttler, globalThreshold time.Duration) Throttler {
+	return &globalCap{next: next, threshold: globalThreshold}
+}
+
+type globalCap struct {
+	next      Throttler
+	threshold time.Duration
+}
+
+func (g *globalCap) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return g.LinearThrottleCtx(context.Background(), threshold, identifier)
+}
+
+func (g *globalCap) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return g.ExponentialThrottleCtx(context.Background(), threshold, identifier)
+}
+
+func (g *globalCap) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	global := LinearThrottleCtx(ctx, g.next, g.threshold, globalKey)
+	return g.combine(global, LinearThrottleCtx(ctx, g.next, threshold, identifier))
+}
+
+func (g *globalCap) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	global := LinearThrottleCtx(ctx, g.next, g.threshold, globalKey)
+	return g.combine(global, ExponentialThrottleCtx(ctx, g.next, threshold, identifier))
+}
+
+// Close closes the wrapped Throttler in case it implements Closer.
+func (g *globalCap) Close(ctx context.Context) error {
+	if c, ok := g.next.(Closer); ok {
+		return c.Close(ctx)
+	}
+	return nil
+}
+
+func (g *globalCap) combine(global, own <-chan Result) <-chan Result {
+	return throttleAll(func() []Result {
+		result := <-global
+		result.Source = GlobalSource
+		return []Result{result, <-own}
+	})
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGlobalCap(t *testing.T) {
+	limiter, _ := NewLimiter(time.Millisecond, &mockGetSetter{})
+	capped := GlobalCap(limiter, time.Minute)
+
+	tests := []struct {
+		identifier    string
+		expectedError error
+	}{
+		{"a", nil},
+		{"b", ErrWouldExceedDeadline},
+		{"c", ErrWouldExceedDeadline},
+	}
+	// each identifier is used once only, so per-identifier limits are
+	// always satisfied
+	for _, test := range tests {
+		t.Run(test.identifier, func(t *testing.T) {
+			result := <-capped.LinearThrottle(time.Millisecond, test.identifier)
+			if !errors.Is(result.Error, test.expectedError) {
+				t.Errorf("Expected %v, got %v", test.expectedError, result.Error)
+			}
+		})
+	}
+
+	uncapped := GlobalCap(New(time.Millisecond, &mockGetSetter{}), time.Millisecond)
+	for _, identifier := range []string{"a", "b"} {
+		time.Sleep(2 * time.Millisecond)
+		if result := <-uncapped.ExponentialThrottle(time.Minute, identifier); result.Error != nil {
+			t.Errorf("Unexpected error %v", result.Error)
+		}
+	}
+}
+
+func TestGlobalCap_Source(t *testing.T) {
+	limiter, _ := NewLimiter(time.Millisecond, &mockGetSetter{}, WithNamespace("api"))
+	capped := GlobalCap(limiter, time.Minute)
+
+	<-capped.LinearThrottle(time.Millisecond, "a")
+	if result := <-capped.LinearThrottle(time.Millisecond, "b"); result.Source != GlobalSource {
+		t.Errorf("Expected %v, got %v", GlobalSource, result.Source)
+	}
+
+	limiter, _ = NewLimiter(time.Millisecond, &mockGetSetter{}, WithNamespace("api"))
+	uncapped := GlobalCap(limiter, time.Nanosecond)
+	<-uncapped.LinearThrottle(time.Minute, "c")
+	if result := <-uncapped.LinearThrottle(time.Minute, "c"); result.Source != "api" {
+		t.Errorf("Expected %v, got %v", "api", result.Source)
+	}
+}
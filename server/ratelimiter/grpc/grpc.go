@@ -0,0 +1,82 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package grpc provides gRPC server interceptors for rate limiting calls
+// using a ratelimiter.Throttler.
+package grpc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter"
+	grpcgo "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns an interceptor that throttles each unary
+// call using the key returned by keyFunc, which allows rate limiting by e.g.
+// metadata or peer information. Calls that are limited in any way, use a
+// blocked identifier or hit an open circuit breaker are rejected with
+// codes.ResourceExhausted, and a retry-after header carrying the required
+// delay in seconds is set. Other errors result in codes.Internal.
+func UnaryServerInterceptor(t ratelimiter.Throttler, threshold time.Duration, keyFunc func(context.Context) string) grpcgo.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpcgo.UnaryServerInfo, handler grpcgo.UnaryHandler) (interface{}, error) {
+		if err := throttle(ctx, t, threshold, keyFunc(ctx), func(md metadata.MD) error {
+			return grpcgo.SetHeader(ctx, md)
+		}); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor works like UnaryServerInterceptor, but throttles
+// each stream once when it is opened.
+func StreamServerInterceptor(t ratelimiter.Throttler, threshold time.Duration, keyFunc func(context.Context) string) grpcgo.StreamServerInterceptor {
+	return func(srv interface{}, ss grpcgo.ServerStream, info *grpcgo.StreamServerInfo, handler grpcgo.StreamHandler) error {
+		ctx := ss.Context()
+		if err := throttle(ctx, t, threshold, keyFunc(ctx), ss.SetHeader); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func throttle(ctx context.Context, t ratelimiter.Throttler, threshold time.Duration, key string, setHeader func(metadata.MD) error) error {
+	result := <-ratelimiter.LinearThrottleCtx(ctx, t, threshold, key)
+	switch {
+	case result.Error == nil:
+		return nil
+	case errors.Is(result.Error, ratelimiter.ErrWouldExceedDeadline),
+		errors.Is(result.Error, ratelimiter.ErrBlockTooLong),
+		errors.Is(result.Error, ratelimiter.ErrBlocked),
+		errors.Is(result.Error, ratelimiter.ErrOpen),
+		errors.Is(result.Error, ratelimiter.ErrBucketFull),
+		errors.Is(result.Error, ratelimiter.ErrTooManyInflight),
+		errors.Is(result.Error, ratelimiter.ErrTooManyConcurrent):
+		setHeader(metadata.Pairs("retry-after", retryAfter(result.Delay)))
+		return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry in %v", result.Delay)
+	case errors.Is(result.Error, context.Canceled):
+		return status.Error(codes.Canceled, result.Error.Error())
+	case errors.Is(result.Error, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, result.Error.Error())
+	default:
+		return status.Error(codes.Internal, "error applying rate limit")
+	}
+}
+
+// retryAfter formats the given delay as a number of seconds, rounding up
+// so clients do not retry too early.
+func retryAfter(delay time.Duration) string {
+	seconds := int64(math.Ceil(delay.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
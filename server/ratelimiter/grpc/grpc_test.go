@@ -0,0 +1,184 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package grpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter"
+	grpcgo "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type mockCache struct {
+	lock   sync.Mutex
+	values map[string]interface{}
+}
+
+func (m *mockCache) Get(key string) (interface{}, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	v, ok := m.values[key]
+	return v, ok
+}
+
+func (m *mockCache) Set(key string, value interface{}, expiry time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.values == nil {
+		m.values = map[string]interface{}{}
+	}
+	m.values[key] = value
+}
+
+// errThrottler rejects all calls using the given error.
+type errThrottler struct {
+	err error
+}
+
+func (e *errThrottler) LinearThrottle(threshold time.Duration, identifier string) <-chan ratelimiter.Result {
+	return e.LinearThrottleCtx(context.Background(), threshold, identifier)
+}
+
+func (e *errThrottler) ExponentialThrottle(threshold time.Duration, identifier string) <-chan ratelimiter.Result {
+	return e.LinearThrottleCtx(context.Background(), threshold, identifier)
+}
+
+func (e *errThrottler) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan ratelimiter.Result {
+	out := make(chan ratelimiter.Result, 1)
+	out <- ratelimiter.Result{Error: e.err}
+	return out
+}
+
+func (e *errThrottler) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan ratelimiter.Result {
+	return e.LinearThrottleCtx(ctx, threshold, identifier)
+}
+
+func keyFromMetadata(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("x-key"); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func newTestClient(t *testing.T) healthpb.HealthClient {
+	limiter, _ := ratelimiter.NewLimiter(time.Millisecond, &mockCache{})
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpcgo.NewServer(
+		grpcgo.UnaryInterceptor(UnaryServerInterceptor(limiter, time.Minute, keyFromMetadata)),
+		grpcgo.StreamInterceptor(StreamServerInterceptor(limiter, time.Minute, keyFromMetadata)),
+	)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(listener)
+
+	conn, err := grpcgo.Dial(
+		"bufnet",
+		grpcgo.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpcgo.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+	})
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	client := newTestClient(t)
+	tests := []struct {
+		name               string
+		key                string
+		expectedCode       codes.Code
+		expectedRetryAfter string
+	}{
+		{"first call", "a", codes.OK, ""},
+		{"throttled", "a", codes.ResourceExhausted, "60"},
+		{"other key", "b", codes.OK, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "x-key", test.key)
+			var header metadata.MD
+			_, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpcgo.Header(&header))
+			if code := status.Code(err); code != test.expectedCode {
+				t.Errorf("Expected code %v, got %v", test.expectedCode, code)
+			}
+			var retryAfter string
+			if values := header.Get("retry-after"); len(values) > 0 {
+				retryAfter = values[0]
+			}
+			if retryAfter != test.expectedRetryAfter {
+				t.Errorf("Expected retry-after of %q, got %q", test.expectedRetryAfter, retryAfter)
+			}
+		})
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	client := newTestClient(t)
+	tests := []struct {
+		name         string
+		key          string
+		expectedCode codes.Code
+	}{
+		{"first call", "a", codes.OK},
+		{"throttled", "a", codes.ResourceExhausted},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(context.Background(), "x-key", test.key))
+			defer cancel()
+			stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			_, err = stream.Recv()
+			if code := status.Code(err); code != test.expectedCode {
+				t.Errorf("Expected code %v, got %v", test.expectedCode, code)
+			}
+		})
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected codes.Code
+	}{
+		{nil, codes.OK},
+		{ratelimiter.ErrWouldExceedDeadline, codes.ResourceExhausted},
+		{ratelimiter.ErrBlockTooLong, codes.ResourceExhausted},
+		{ratelimiter.ErrBlocked, codes.ResourceExhausted},
+		{ratelimiter.ErrOpen, codes.ResourceExhausted},
+		{ratelimiter.ErrBucketFull, codes.ResourceExhausted},
+		{ratelimiter.ErrTooManyInflight, codes.ResourceExhausted},
+		{ratelimiter.ErrTooManyConcurrent, codes.ResourceExhausted},
+		{context.Canceled, codes.Canceled},
+		{context.DeadlineExceeded, codes.DeadlineExceeded},
+		{ratelimiter.ErrInvalidCache, codes.Internal},
+	}
+	for _, test := range tests {
+		err := throttle(context.Background(), &errThrottler{test.err}, time.Minute, "key", func(metadata.MD) error {
+			return nil
+		})
+		if code := status.Code(err); code != test.expected {
+			t.Errorf("Expected %v for %v, got %v", test.expected, test.err, code)
+		}
+	}
+}
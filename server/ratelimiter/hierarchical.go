@@ -0,0 +1,115 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Level is a single level of a Hierarchical throttler. Name is used as the
+// Source of results governed by the level, defaulting to the namespace of
+// the Limiter.
+type Level struct {
+	Limiter   *Limiter
+	Threshold time.Duration
+	Name      string
+}
+
+func (l Level) source() string {
+	if l.Name != "" {
+		return l.Name
+	}
+	return l.Limiter.namespace
+}
+
+// Hierarchical enforces limits on several nested levels at once, e.g.
+// a global limit, a limit per tenant and a limit per user.
+type Hierarchical struct {
+	levels []Level
+}
+
+// NewHierarchical creates a new Hierarchical throttler using the given
+// levels, ordered from the outermost to the innermost. Waiting for the
+// required delay is handled using the options of the first level. At least
+// one level is required, and each level needs a Limiter.
+func NewHierarchical(levels ...Level) (*Hierarchical, error) {
+	if len(levels) == 0 {
+		return nil, errors.New("ratelimiter: at least one level is required")
+	}
+	for _, level := range levels {
+		if level.Limiter == nil {
+			return nil, errors.New("ratelimiter: each level requires a limiter")
+		}
+	}
+	return &Hierarchical{levels: append([]Level{}, levels...)}, nil
+}
+
+// Throttle throttles a call on all levels, waiting for the most restrictive
+// delay. The first level is keyed globally, and each further level is
+// keyed by one more element of the given path, e.g. Throttle(ctx, tenant,
+// user) for levels limiting globally, per tenant and per user. Levels
+// without a matching path element are skipped.
+//
+// Slots are reserved on each level in order using Reserve, so each level
+// applies its own circuit breaker, dry run, observer and history, and
+// rejects calls once it has been closed. In case a level rejects the call,
+// the slots already reserved on the previous levels are returned, so
+// rejected calls are never counted on any level.
+func (h *Hierarchical) Throttle(ctx context.Context, path ...string) <-chan Result {
+	levels := h.levels
+	if len(levels) > len(path)+1 {
+		levels = levels[:len(path)+1]
+	}
+	first := h.levels[0].Limiter
+	// closing the first level waits for calls that are still waiting
+	if !first.drain.acquire() {
+		return first.wait(ctx, Result{Error: ErrClosed}, func() {})
+	}
+	delay, source, err := reserveLevels(levels, path)
+	if err == nil && delay > 0 {
+		delay = first.applyJitter(delay)
+	}
+	result := first.shape(delay, err)
+	if source != "" {
+		result.Source = source
+	}
+	return first.wait(ctx, result, first.drain.release)
+}
+
+// reserveLevels reserves a slot on each of the given levels, returning the
+// largest delay and the source of the level that required it.
+func reserveLevels(levels []Level, path []string) (time.Duration, string, error) {
+	var reservations []*Reservation
+	var delay time.Duration
+	var source string
+	for i, level := range levels {
+		r, err := level.Limiter.Reserve(level.Threshold, ThrottleKey(path[:i]...))
+		if err != nil {
+			for _, reserved := range reservations {
+				reserved.Cancel()
+			}
+			return levelDelay(err), level.source(), err
+		}
+		reservations = append(reservations, r)
+		if r.Delay > delay {
+			delay, source = r.Delay, level.source()
+		}
+	}
+	for _, r := range reservations {
+		r.Commit()
+	}
+	return delay, source, nil
+}
+
+// levelDelay returns the delay that has been required by a level returning
+// the given error.
+func levelDelay(err error) time.Duration {
+	var d *DeadlineExceededError
+	if errors.As(err, &d) {
+		return d.Remaining
+	}
+	return 0
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestHierarchical(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	global, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithClock(clock))
+	tenant, _ := NewLimiter(time.Minute, &mockGetSetter{}, WithClock(clock), WithNamespace("tenant"))
+	user, _ := NewLimiter(time.Millisecond, &mockGetSetter{}, WithClock(clock))
+	h, _ := NewHierarchical(
+		Level{Limiter: global, Threshold: time.Nanosecond},
+		Level{Limiter: tenant, Threshold: time.Second},
+		Level{Limiter: user, Threshold: time.Hour, Name: "user"},
+	)
+
+	tests := []struct {
+		name           string
+		path           []string
+		expectedError  error
+		expectedSource string
+	}{
+		{"first call", []string{"tenant", "a"}, nil, ""},
+		{"other user", []string{"tenant", "b"}, nil, ""},
+		{"tenant only", []string{"tenant"}, nil, ""},
+		{"throttled user", []string{"tenant", "a"}, ErrWouldExceedDeadline, "user"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := <-h.Throttle(context.Background(), test.path...)
+			if !errors.Is(result.Error, test.expectedError) {
+				t.Errorf("Expected %v, got %v", test.expectedError, result.Error)
+			}
+			if result.Source != test.expectedSource {
+				t.Errorf("Expected %v, got %v", test.expectedSource, result.Source)
+			}
+		})
+		clock.Advance(time.Second)
+	}
+
+	// the rejected call must not have been counted on the tenant level
+	if delay, ok := tenant.Peek(ThrottleKey("tenant")); ok {
+		t.Errorf("Expected tenant not to be limited, got %v", delay)
+	}
+}
+
+func TestHierarchical_LevelOptions(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	global, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithClock(clock), WithMaxInflight(1))
+	tenant, _ := NewLimiter(time.Millisecond, &mockGetSetter{}, WithClock(clock), WithCircuitBreaker(1, time.Hour))
+	user, _ := NewLimiter(time.Millisecond, &mockGetSetter{}, WithClock(clock))
+	h, _ := NewHierarchical(
+		Level{Limiter: global, Threshold: time.Nanosecond},
+		Level{Limiter: tenant, Threshold: time.Hour},
+		Level{Limiter: user, Threshold: time.Nanosecond},
+	)
+
+	user.Close(context.Background())
+	tests := []struct {
+		name          string
+		path          []string
+		expectedError error
+	}{
+		{"first call", []string{"tenant"}, nil},
+		{"throttled tenant", []string{"tenant"}, ErrWouldExceedDeadline},
+		{"open breaker", []string{"tenant"}, ErrOpen},
+		{"closed level", []string{"other", "a"}, ErrClosed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := <-h.Throttle(context.Background(), test.path...); !errors.Is(result.Error, test.expectedError) {
+				t.Errorf("Expected %v, got %v", test.expectedError, result.Error)
+			}
+		})
+	}
+}
+
+func TestNewHierarchical(t *testing.T) {
+	if _, err := NewHierarchical(); err == nil {
+		t.Error("Expected error when passing no levels")
+	}
+	if _, err := NewHierarchical(Level{Threshold: time.Second}); err == nil {
+		t.Error("Expected error when passing level without limiter")
+	}
+}
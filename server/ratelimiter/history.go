@@ -0,0 +1,99 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Outcome describes how a call has been decided on.
+type Outcome string
+
+// The outcomes recorded in a DecisionRecord.
+const (
+	OutcomeAllowed   Outcome = "allowed"
+	OutcomeThrottled Outcome = "throttled"
+	OutcomeRejected  Outcome = "rejected"
+)
+
+// DecisionRecord describes a single decision made by a throttler as
+// returned by History.
+type DecisionRecord struct {
+	Time    time.Time     `json:"time"`
+	Key     string        `json:"key"`
+	Outcome Outcome       `json:"outcome"`
+	Delay   time.Duration `json:"delay"`
+	Error   error         `json:"-"`
+}
+
+// WithHistory makes the throttler keep a record of the most recent `size`
+// decisions, which can be retrieved using History, e.g. for exposing them
+// on a debug endpoint. Once size decisions have been recorded, each new
+// decision replaces the oldest one.
+func WithHistory(size int) Option {
+	return func(o *options) {
+		o.historySize = size
+	}
+}
+
+// history is a ring buffer of decisions.
+type history struct {
+	mu      sync.Mutex
+	records []DecisionRecord
+	next    int
+	full    bool
+}
+
+func newHistory(size int) *history {
+	return &history{records: make([]DecisionRecord, size)}
+}
+
+func (h *history) add(record DecisionRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records[h.next] = record
+	h.next = (h.next + 1) % len(h.records)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+func (h *history) snapshot() []DecisionRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.full {
+		return append([]DecisionRecord{}, h.records[:h.next]...)
+	}
+	return append(append([]DecisionRecord{}, h.records[h.next:]...), h.records[:h.next]...)
+}
+
+// History returns the decisions recorded using WithHistory, oldest first.
+// It returns nil in case WithHistory has not been used.
+func (o *options) History() []DecisionRecord {
+	if o.history == nil {
+		return nil
+	}
+	return o.history.snapshot()
+}
+
+func (o *options) record(key string, delay time.Duration, err error) {
+	if o.history == nil {
+		return
+	}
+	outcome := OutcomeAllowed
+	switch {
+	case err != nil:
+		outcome = OutcomeRejected
+	case delay > 0:
+		outcome = OutcomeThrottled
+	}
+	o.history.add(DecisionRecord{
+		Time:    o.clock.Now(),
+		Key:     key,
+		Outcome: outcome,
+		Delay:   delay,
+		Error:   err,
+	})
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestWithHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		calls    int
+		expected []string
+	}{
+		{"empty", 0, []string{}},
+		{"partial", 2, []string{"id-0", "id-1"}},
+		{"full", 3, []string{"id-0", "id-1", "id-2"}},
+		{"wraparound", 5, []string{"id-2", "id-3", "id-4"}},
+		{"multiple wraparounds", 7, []string{"id-4", "id-5", "id-6"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithHistory(3), WithPlaintextKeys())
+			for i := 0; i < test.calls; i++ {
+				<-limiter.LinearThrottle(time.Minute, fmt.Sprintf("id-%d", i))
+			}
+			keys := []string{}
+			for _, record := range limiter.History() {
+				keys = append(keys, record.Key)
+			}
+			if !reflect.DeepEqual(keys, test.expected) {
+				t.Errorf("Expected %v, got %v", test.expected, keys)
+			}
+		})
+	}
+}
+
+func TestWithHistory_Outcomes(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := ratelimitertest.NewFakeClock(now)
+	limiter, _ := NewLimiter(time.Minute, &mockGetSetter{}, WithClock(clock), WithHistory(10))
+
+	// delayed calls are recorded as soon as they have been decided on
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 3; i++ {
+		<-limiter.LinearThrottleCtx(ctx, time.Minute, "outcome")
+	}
+
+	history := limiter.History()
+	expected := []Outcome{OutcomeAllowed, OutcomeThrottled, OutcomeRejected}
+	if len(history) != len(expected) {
+		t.Fatalf("Expected %d records, got %d", len(expected), len(history))
+	}
+	for i, record := range history {
+		if record.Outcome != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], record.Outcome)
+		}
+		if !record.Time.Equal(now) {
+			t.Errorf("Expected %v, got %v", now, record.Time)
+		}
+	}
+	if history[1].Delay != time.Minute {
+		t.Errorf("Expected %v, got %v", time.Minute, history[1].Delay)
+	}
+	if !errors.Is(history[2].Error, ErrWouldExceedDeadline) {
+		t.Errorf("Expected %v, got %v", ErrWouldExceedDeadline, history[2].Error)
+	}
+}
+
+func TestWithHistory_Disabled(t *testing.T) {
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{})
+	<-limiter.LinearThrottle(time.Minute, "disabled")
+	if history := limiter.History(); history != nil {
+		t.Errorf("Expected no history, got %v", history)
+	}
+	if _, err := NewLimiter(time.Hour, &mockGetSetter{}, WithHistory(-1)); err == nil {
+		t.Error("Expected error when passing negative size")
+	}
+}
+
+func TestWithHistory_Concurrent(t *testing.T) {
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithHistory(8))
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-limiter.LinearThrottle(time.Minute, fmt.Sprintf("id-%d", i))
+			limiter.History()
+		}(i)
+	}
+	wg.Wait()
+	if history := limiter.History(); len(history) != 8 {
+		t.Errorf("Expected %d records, got %d", 8, len(history))
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"time"
+)
+
+// defaultIdempotencyTTL is the time idempotency keys are remembered for
+// unless configured otherwise using WithIdempotencyTTL.
+const defaultIdempotencyTTL = 5 * time.Minute
+
+// WithIdempotencyTTL sets the time idempotency keys passed to
+// LinearThrottleIdempotent are remembered for. It defaults to five minutes.
+func WithIdempotencyTTL(d time.Duration) Option {
+	return func(o *options) {
+		o.idempotencyTTL = d
+	}
+}
+
+// idempotencyItem stores the time a call using an idempotency key has been
+// admitted at.
+type idempotencyItem struct {
+	admitAt time.Time
+}
+
+type encodedIdempotencyItem struct {
+	AdmitAt time.Time `json:"admitAt"`
+}
+
+func (i idempotencyItem) MarshalBinary() ([]byte, error) {
+	return envelope(json.Marshal(encodedIdempotencyItem{
+		AdmitAt: i.admitAt,
+	}))
+}
+
+func (i *idempotencyItem) UnmarshalBinary(data []byte) error {
+	var e encodedIdempotencyItem
+	if err := openEnvelope(data, &e); err != nil {
+		return err
+	}
+	if e.AdmitAt.IsZero() {
+		return errors.New("ratelimiter: value is not an idempotency key")
+	}
+	i.admitAt = e.AdmitAt
+	return nil
+}
+
+func decodeIdempotencyItem(value interface{}) (idempotencyItem, bool) {
+	switch v := value.(type) {
+	case idempotencyItem:
+		return v, true
+	case []byte:
+		var item idempotencyItem
+		err := item.UnmarshalBinary(v)
+		return item, err == nil
+	default:
+		return idempotencyItem{}, false
+	}
+}
+
+func idempotencyKeyFor(key string) string {
+	return key + ":idempotency"
+}
+
+// LinearThrottleIdempotent works like LinearThrottle, but only the first
+// call using the given idempotency key advances the limit, e.g. for not
+// charging clients retrying a request for the same logical operation.
+// Subsequent calls using the same idempotency key within the time set
+// using WithIdempotencyTTL wait until the time the first call has been
+// admitted at. Calls that have been rejected are not remembered. Concurrent
+// calls using the same idempotency key collapse into a single one, also
+// across instances when the cache implements Adder.
+func (l *Limiter) LinearThrottleIdempotent(threshold time.Duration, identifier, idempotencyKey string) <-chan Result {
+	hashedIdentifier := l.key(identifier)
+	dedupKey := idempotencyKeyFor(l.hash(ThrottleKey(identifier, idempotencyKey)))
+	return l.run(context.Background(), hashedIdentifier, l.guard(l.cache, hashedIdentifier, func() (time.Duration, error) {
+		return l.allowIdempotent(threshold, hashedIdentifier, dedupKey)
+	}))
+}
+
+func (l *Limiter) allowIdempotent(threshold time.Duration, hashedIdentifier, dedupKey string) (time.Duration, error) {
+	// calls within the same instance are serialized, so caches that do
+	// not support atomic updates still do not count retries twice
+	h := fnv.New32a()
+	h.Write([]byte(dedupKey))
+	lock := &l.idempotencyLocks[h.Sum32()%uint32(len(l.idempotencyLocks))]
+	lock.Lock()
+	defer lock.Unlock()
+
+	if delay, seen, err := l.seen(dedupKey); err != nil || seen {
+		return delay, err
+	}
+
+	now := l.clock.Now()
+	delay, err := l.allow(threshold, hashedIdentifier, false, 0)
+	if err != nil {
+		return delay, err
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	admitAt := now.Add(delay)
+
+	ttl := l.idempotencyTTL
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	ok, err := update(l.cache, dedupKey, nil, idempotencyItem{admitAt: admitAt}, ttl)
+	if err != nil {
+		l.release(hashedIdentifier, threshold, admitAt.Add(threshold))
+		return l.handleCacheError(err)
+	}
+	if !ok {
+		if delay, seen, err := l.seen(dedupKey); err != nil || seen {
+			// another instance has admitted a call using the same
+			// idempotency key in the meantime, so the slot is returned
+			l.release(hashedIdentifier, threshold, admitAt.Add(threshold))
+			return delay, err
+		}
+		// values that cannot be decoded are replaced
+		update(l.cache, dedupKey, replace, idempotencyItem{admitAt: admitAt}, ttl)
+	}
+	return delay, nil
+}
+
+// seen returns the remaining delay of a call that has been admitted using
+// the given idempotency key before.
+func (l *Limiter) seen(dedupKey string) (time.Duration, bool, error) {
+	value, found, err := getErr(l.cache, dedupKey)
+	if err != nil {
+		delay, err := l.handleReadError(err)
+		return delay, err == nil, err
+	}
+	if !found {
+		return 0, false, nil
+	}
+	item, ok := decodeIdempotencyItem(value)
+	if !ok {
+		return 0, false, nil
+	}
+	delay := item.admitAt.Sub(l.clock.Now())
+	if delay < 0 {
+		delay = 0
+	}
+	return delay, true, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestLimiter_LinearThrottleIdempotent(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := ratelimitertest.NewFakeClock(now)
+	cache := ratelimitertest.NewRecordingCache(clock)
+	limiter, _ := NewLimiter(time.Millisecond, cache, WithClock(clock), WithIdempotencyTTL(time.Hour))
+
+	tests := []struct {
+		name           string
+		idempotencyKey string
+		advance        time.Duration
+		expectedError  error
+	}{
+		{"first call", "a", 0, nil},
+		{"retry", "a", 0, nil},
+		{"other operation", "b", 0, ErrWouldExceedDeadline},
+		{"retry after limit", "a", time.Minute, nil},
+		{"other operation after limit", "b", 0, nil},
+		{"retry after ttl", "a", time.Hour, nil},
+		{"retry after ttl again", "a", 0, nil},
+		{"limit after ttl", "c", 0, ErrWouldExceedDeadline},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock.Advance(test.advance)
+			result := <-limiter.LinearThrottleIdempotent(time.Minute, "id", test.idempotencyKey)
+			if !errors.Is(result.Error, test.expectedError) {
+				t.Errorf("Expected %v, got %v", test.expectedError, result.Error)
+			}
+		})
+	}
+}
+
+func TestLimiter_LinearThrottleIdempotent_Concurrent(t *testing.T) {
+	limiter, _ := NewLimiter(time.Millisecond, &mockGetSetter{})
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var errs []error
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := <-limiter.LinearThrottleIdempotent(time.Minute, "id", "key")
+			lock.Lock()
+			defer lock.Unlock()
+			errs = append(errs, result.Error)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+	if remaining, _ := limiter.Peek("id"); remaining > time.Minute {
+		t.Errorf("Expected limit to be advanced once, got %v", remaining)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"sort"
+	"time"
+)
+
+// StateSnapshot describes the state stored for a single identifier at the
+// time it has been inspected, e.g. for displaying it in admin tooling.
+type StateSnapshot struct {
+	// Key is the cache key the state is stored at.
+	Key string `json:"key"`
+	// BlockUntil is the time until which calls are throttled as stored.
+	// It is zero in case no limit is stored.
+	BlockUntil time.Time `json:"blockUntil,omitempty"`
+	// Remaining is the delay a call would currently be throttled by.
+	Remaining time.Duration `json:"remaining"`
+	// Limited is set in case a call would currently be throttled.
+	Limited bool `json:"limited"`
+	// Blocked is set in case the identifier has been blocked using Block.
+	Blocked bool `json:"blocked"`
+	// BlockedUntil is the time until which the identifier is blocked.
+	BlockedUntil time.Time `json:"blockedUntil,omitempty"`
+	// BlockReason is the reason given when blocking the identifier.
+	BlockReason string `json:"blockReason,omitempty"`
+	// Open is set in case the circuit breaker for the identifier is open.
+	Open bool `json:"open"`
+}
+
+// Inspect returns a snapshot of the state stored for the given identifier
+// without updating it. It returns ErrInvalidCache in case the stored value
+// cannot be read.
+func (l *Limiter) Inspect(identifier string) (StateSnapshot, error) {
+	var snapshot StateSnapshot
+	now := l.clock.Now()
+	key, value, found := l.lookup(identifier)
+	if found {
+		var ok bool
+		if snapshot, ok = l.snapshot(value, now); !ok {
+			return StateSnapshot{}, ErrInvalidCache
+		}
+	}
+	snapshot.Key = key
+	snapshot.Open = l.open(key, now)
+	return snapshot, nil
+}
+
+// SoonestExpiring returns snapshots of up to n identifiers that are
+// currently throttled, sorted by the time they will be allowed again,
+// soonest first. This requires the cache to implement Enumerator and
+// returns an error otherwise. As entries are read one by one, the result
+// is best-effort and might be inconsistent when limits are updated
+// concurrently.
+func (l *Limiter) SoonestExpiring(n int) ([]StateSnapshot, error) {
+	e, ok := l.cache.(Enumerator)
+	if !ok {
+		return nil, errEnumerateUnsupported
+	}
+	now := l.clock.Now()
+	var snapshots []StateSnapshot
+	for _, key := range e.Keys() {
+		if _, ok := l.owns(key); !ok {
+			continue
+		}
+		value, found := l.cache.Get(key)
+		if !found {
+			continue
+		}
+		// values other than limits, e.g. circuit breaker state, are
+		// skipped here
+		snapshot, ok := l.snapshot(value, now)
+		if !ok || !snapshot.Limited {
+			continue
+		}
+		snapshot.Key = key
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].BlockUntil.Before(snapshots[j].BlockUntil)
+	})
+	if n >= 0 && len(snapshots) > n {
+		snapshots = snapshots[:n]
+	}
+	for i := range snapshots {
+		snapshots[i].Open = l.open(snapshots[i].Key, now)
+	}
+	return snapshots, nil
+}
+
+// snapshot describes the given stored value, returning false in case it
+// is not a limit.
+func (l *Limiter) snapshot(value interface{}, now time.Time) (StateSnapshot, bool) {
+	var snapshot StateSnapshot
+	if block, ok := decodeBlockItem(value); ok {
+		snapshot.Blocked = block.until.After(now)
+		snapshot.BlockedUntil = block.until
+		snapshot.BlockReason = block.reason
+		snapshot.BlockUntil = block.until
+	} else if item, ok := decodeCacheItem(value); ok {
+		snapshot.BlockUntil = item.rebase(now).blockUntil
+	} else {
+		return snapshot, false
+	}
+	if remaining := snapshot.BlockUntil.Sub(now); remaining > 0 {
+		snapshot.Remaining, snapshot.Limited = remaining, true
+	}
+	return snapshot, true
+}
+
+// open reports whether the circuit breaker for the given key is open.
+func (l *Limiter) open(key string, now time.Time) bool {
+	if value, found := l.cache.Get(breakerKey(key)); found {
+		if item, ok := decodeBreakerItem(value); ok {
+			return item.openUntil.After(now)
+		}
+	}
+	return false
+}
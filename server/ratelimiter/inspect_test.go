@@ -0,0 +1,141 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/memory"
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestLimiter_Inspect(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := ratelimitertest.NewFakeClock(now)
+	cache := ratelimitertest.NewRecordingCache(clock)
+	limiter, _ := NewLimiter(time.Hour, cache, WithClock(clock))
+
+	limiter.LinearAllow(time.Minute, "limited")
+	limiter.Block("blocked", now.Add(time.Hour), "abuse")
+	cache.Set(limiter.Key("invalid"), []byte("{}}"), time.Hour)
+
+	tests := []struct {
+		identifier       string
+		expectedSnapshot StateSnapshot
+		expectedError    error
+	}{
+		{"unknown", StateSnapshot{}, nil},
+		{"limited", StateSnapshot{BlockUntil: now.Add(time.Minute), Remaining: time.Minute, Limited: true}, nil},
+		{"blocked", StateSnapshot{
+			BlockUntil:   now.Add(time.Hour),
+			Remaining:    time.Hour,
+			Limited:      true,
+			Blocked:      true,
+			BlockedUntil: now.Add(time.Hour),
+			BlockReason:  "abuse",
+		}, nil},
+		{"invalid", StateSnapshot{}, ErrInvalidCache},
+	}
+	for _, test := range tests {
+		t.Run(test.identifier, func(t *testing.T) {
+			calls := len(cache.Calls())
+			if test.expectedError == nil {
+				test.expectedSnapshot.Key = limiter.Key(test.identifier)
+			}
+			snapshot, err := limiter.Inspect(test.identifier)
+			if err != test.expectedError {
+				t.Errorf("Expected %v, got %v", test.expectedError, err)
+			}
+			if !reflect.DeepEqual(snapshot, test.expectedSnapshot) {
+				t.Errorf("Expected %v, got %v", test.expectedSnapshot, snapshot)
+			}
+			for _, call := range cache.Calls()[calls:] {
+				if call.Op != "Get" {
+					t.Errorf("Unexpected call %v", call)
+				}
+			}
+			if _, err := json.Marshal(snapshot); err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestLimiter_Inspect_RotateSalt(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := ratelimitertest.NewFakeClock(now)
+	limiter, _ := NewLimiter(time.Hour, ratelimitertest.NewRecordingCache(clock), WithClock(clock))
+	limiter.LinearAllow(time.Minute, "previous")
+	previous := limiter.Key("previous")
+	limiter.RotateSalt([]byte("next"), time.Hour)
+
+	tests := []struct {
+		identifier  string
+		expectedKey string
+	}{
+		{"previous", previous},
+		{"unknown", limiter.Key("unknown")},
+	}
+	for _, test := range tests {
+		t.Run(test.identifier, func(t *testing.T) {
+			snapshot, err := limiter.Inspect(test.identifier)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if snapshot.Key != test.expectedKey {
+				t.Errorf("Expected %v, got %v", test.expectedKey, snapshot.Key)
+			}
+		})
+	}
+}
+
+func TestLimiter_SoonestExpiring(t *testing.T) {
+	limiter, _ := NewLimiter(time.Hour, memory.NewCache(time.Minute))
+	for identifier, threshold := range map[string]time.Duration{
+		"c": 3 * time.Minute,
+		"a": time.Minute,
+		"d": 4 * time.Minute,
+		"b": 2 * time.Minute,
+	} {
+		limiter.LinearAllow(threshold, identifier)
+	}
+	limiter.Block("blocked", time.Now().Add(90*time.Second), "")
+
+	tests := []struct {
+		n        int
+		expected []string
+	}{
+		{2, []string{"a", "blocked"}},
+		{10, []string{"a", "blocked", "b", "c", "d"}},
+		{0, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("n=%d", test.n), func(t *testing.T) {
+			snapshots, err := limiter.SoonestExpiring(test.n)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			keys := []string{}
+			for _, snapshot := range snapshots {
+				keys = append(keys, snapshot.Key)
+			}
+			expected := []string{}
+			for _, identifier := range test.expected {
+				expected = append(expected, limiter.Key(identifier))
+			}
+			if !reflect.DeepEqual(keys, expected) {
+				t.Errorf("Expected %v, got %v", expected, keys)
+			}
+		})
+	}
+
+	other, _ := NewLimiter(time.Hour, &mockGetSetter{})
+	if _, err := other.SoonestExpiring(1); err != errEnumerateUnsupported {
+		t.Errorf("Expected %v, got %v", errEnumerateUnsupported, err)
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package value provides helpers shared by the caches in this module.
+package value
+
+import (
+	"bytes"
+)
+
+// Equal compares values stored in a cache. Byte slices, e.g. values
+// restored using Import, cannot be compared using == and are compared
+// by content instead.
+func Equal(a, b interface{}) bool {
+	x, aok := a.([]byte)
+	y, bok := b.([]byte)
+	if aok || bok {
+		return aok && bok && bytes.Equal(x, y)
+	}
+	return a == b
+}
@@ -0,0 +1,30 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package value
+
+import (
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     interface{}
+		expected bool
+	}{
+		{"equal values", 1, 1, true},
+		{"different values", 1, 2, false},
+		{"equal bytes", []byte("a"), []byte("a"), true},
+		{"different bytes", []byte("a"), []byte("b"), false},
+		{"bytes and string", []byte("a"), "a", false},
+		{"nil", nil, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := Equal(test.a, test.b); result != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package ipkey derives identifiers from client IP addresses that are
+// stable across addresses controlled by the same client.
+package ipkey
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IPKey parses the given address, which may or may not contain a port,
+// and masks it to the given prefix length, i.e. `v4Bits` for IPv4 and
+// `v6Bits` for IPv6 addresses. The resulting network is returned in CIDR
+// notation, so for example all addresses within the same /64 map to the
+// same identifier when passing 64 as `v6Bits`.
+func IPKey(remoteAddr string, v4Bits, v6Bits int) (string, error) {
+	if v4Bits < 0 || v4Bits > 8*net.IPv4len {
+		return "", fmt.Errorf("ipkey: invalid IPv4 prefix length %d", v4Bits)
+	}
+	if v6Bits < 0 || v6Bits > 8*net.IPv6len {
+		return "", fmt.Errorf("ipkey: invalid IPv6 prefix length %d", v6Bits)
+	}
+
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", fmt.Errorf("ipkey: unable to parse address %q", remoteAddr)
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		mask := net.CIDRMask(v4Bits, 8*net.IPv4len)
+		return fmt.Sprintf("%s/%d", v4.Mask(mask), v4Bits), nil
+	}
+	mask := net.CIDRMask(v6Bits, 8*net.IPv6len)
+	return fmt.Sprintf("%s/%d", ip.Mask(mask), v6Bits), nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ipkey
+
+import (
+	"testing"
+)
+
+func TestIPKey(t *testing.T) {
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		expectedKey   string
+		expectedError bool
+	}{
+		{"ipv4 with port", "192.168.12.34:8080", "192.168.12.0/24", false},
+		{"bare ipv4", "192.168.12.34", "192.168.12.0/24", false},
+		{"ipv6 with port", "[2001:db8:1:2:3:4:5:6]:443", "2001:db8:1:2::/64", false},
+		{"bare ipv6", "2001:db8:1:2:ffff::1", "2001:db8:1:2::/64", false},
+		{"bracketed ipv6", "[2001:db8:1:2::1]", "2001:db8:1:2::/64", false},
+		{"ipv4 mapped ipv6", "[::ffff:10.0.0.1]:80", "10.0.0.0/24", false},
+		{"malformed", "not-an-ip:80", "", true},
+		{"empty", "", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := IPKey(test.remoteAddr, 24, 64)
+			if (err != nil) != test.expectedError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if key != test.expectedKey {
+				t.Errorf("Expected %v, got %v", test.expectedKey, key)
+			}
+		})
+	}
+}
+
+func TestIPKey_InvalidBits(t *testing.T) {
+	if _, err := IPKey("10.0.0.1", 33, 64); err == nil {
+		t.Error("Expected error for invalid IPv4 prefix length")
+	}
+	if _, err := IPKey("10.0.0.1", 24, -1); err == nil {
+		t.Error("Expected error for invalid IPv6 prefix length")
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ThrottleKey joins the given parts into a single identifier for throttling
+// on composite keys, e.g. an account and an endpoint. Each part is prefixed
+// with its length, so different parts never produce the same identifier
+// no matter which characters they contain. This should be preferred over
+// building identifiers using fmt.Sprintf or plain concatenation whenever any
+// of the parts is user-controlled.
+func ThrottleKey(parts ...string) string {
+	var b strings.Builder
+	for _, part := range parts {
+		b.WriteString(strconv.Itoa(len(part)))
+		b.WriteByte(':')
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// ErrMalformedKey is returned when formatting an identifier fails because
+// the format does not match the arguments given.
+var ErrMalformedKey = errors.New("ratelimiter: malformed key")
+
+// ThrottleKeyf formats an identifier like fmt.Sprintf, but returns
+// ErrMalformedKey in case the format does not match the given arguments,
+// e.g. when an argument is missing, instead of silently using an identifier
+// like "%!s(MISSING)" that would share its limit with all other malformed
+// calls. As errors are detected using the "%!" markers fmt leaves in the
+// result, arguments containing "%!" are rejected as well.
+func ThrottleKeyf(format string, args ...interface{}) (string, error) {
+	key := fmt.Sprintf(format, args...)
+	if strings.Contains(key, "%!") {
+		return "", fmt.Errorf("%w: %q", ErrMalformedKey, key)
+	}
+	return key, nil
+}
+
+// Throttlef linearly throttles calls using the identifier formatted from
+// the given format and arguments using ThrottleKeyf. In case formatting
+// fails, the returned channel yields a Result with an error wrapping
+// ErrMalformedKey and the throttler is not called.
+func Throttlef(ctx context.Context, t Throttler, threshold time.Duration, format string, args ...interface{}) <-chan Result {
+	identifier, err := ThrottleKeyf(format, args...)
+	if err != nil {
+		out := make(chan Result, 1)
+		out <- Result{Error: err}
+		close(out)
+		return out
+	}
+	return LinearThrottleCtx(ctx, t, threshold, identifier)
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestThrottleKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		parts    []string
+		expected string
+	}{
+		{"empty", nil, ""},
+		{"single", []string{"a"}, "1:a"},
+		{"format verbs", []string{"%s%d", "%!"}, "4:%s%d2:%!"},
+		{"separator in part", []string{"a:b", "c"}, "3:a:b1:c"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if key := ThrottleKey(test.parts...); key != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, key)
+			}
+		})
+	}
+}
+
+func TestThrottleKey_Collisions(t *testing.T) {
+	pairs := [][2][]string{
+		{{"a:b", "c"}, {"a", "b:c"}},
+		{{"ab", ""}, {"a", "b"}},
+		{{"1:a"}, {"a"}},
+		{{"%s", "x"}, {"%", "sx"}},
+	}
+	for _, pair := range pairs {
+		if a, b := ThrottleKey(pair[0]...), ThrottleKey(pair[1]...); a == b {
+			t.Errorf("Expected %v and %v to produce different keys, got %v", pair[0], pair[1], a)
+		}
+	}
+}
+
+func TestThrottleKeyf(t *testing.T) {
+	tests := []struct {
+		name          string
+		format        string
+		args          []interface{}
+		expected      string
+		expectedError error
+	}{
+		{"ok", "%s:%d", []interface{}{"account", 12}, "account:12", nil},
+		{"no verbs", "account", nil, "account", nil},
+		{"missing argument", "%s:%s", []interface{}{"account"}, "", ErrMalformedKey},
+		{"extra argument", "%s", []interface{}{"account", "endpoint"}, "", ErrMalformedKey},
+		{"wrong type", "%d", []interface{}{"account"}, "", ErrMalformedKey},
+		{"bad index", "%[2]s", []interface{}{"account"}, "", ErrMalformedKey},
+		{"no verb", "account%", nil, "", ErrMalformedKey},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := ThrottleKeyf(test.format, test.args...)
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("Expected %v, got %v", test.expectedError, err)
+			}
+			if key != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, key)
+			}
+		})
+	}
+}
+
+func TestThrottlef(t *testing.T) {
+	throttler := &countingThrottler{}
+	// the format is not a constant so vet does not catch the mismatch
+	format := "%s:%s"
+	if result := <-Throttlef(context.Background(), throttler, time.Second, format, "account"); !errors.Is(result.Error, ErrMalformedKey) {
+		t.Errorf("Expected %v, got %v", ErrMalformedKey, result.Error)
+	}
+	if throttler.calls != 0 {
+		t.Errorf("Expected malformed key not to be throttled, got %d calls", throttler.calls)
+	}
+	if result := <-Throttlef(context.Background(), throttler, time.Second, format, "account", "endpoint"); result.Error != nil {
+		t.Errorf("Unexpected error %v", result.Error)
+	}
+	if throttler.calls != 1 {
+		t.Errorf("Expected %d calls, got %d", 1, throttler.calls)
+	}
+}
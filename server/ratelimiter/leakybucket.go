@@ -0,0 +1,133 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrBucketFull is returned by LeakyBucket when a call would exceed the
+// bucket's capacity.
+var ErrBucketFull = errors.New("ratelimiter: bucket is full")
+
+// LeakyBucket is a Throttler that lets calls for the same identifier pass
+// at a steady rate of one call per `threshold`. Calls are queued in a
+// bucket of `capacity` calls, calls that would overflow the bucket are
+// rejected using ErrBucketFull instead of being queued.
+type LeakyBucket struct {
+	options
+	capacity int
+	cache    GetSetter
+}
+
+type leakyItem struct {
+	level    float64
+	lastLeak time.Time
+}
+
+// LinearThrottle returns a channel that blocks until all calls queued
+// before this call have drained at a rate of one call per threshold.
+func (b *LeakyBucket) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return b.LinearThrottleCtx(context.Background(), threshold, identifier)
+}
+
+// ExponentialThrottle behaves exactly like LinearThrottle as a leaky bucket
+// drains at a steady rate.
+func (b *LeakyBucket) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return b.LinearThrottleCtx(context.Background(), threshold, identifier)
+}
+
+// LinearThrottleCtx works like LinearThrottle, but stops waiting as soon as
+// the given context is cancelled.
+func (b *LeakyBucket) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return b.throttle(ctx, threshold, identifier)
+}
+
+// ExponentialThrottleCtx behaves exactly like LinearThrottleCtx.
+func (b *LeakyBucket) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return b.throttle(ctx, threshold, identifier)
+}
+
+func (b *LeakyBucket) throttle(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	hashedIdentifier := b.hash(identifier)
+	var d decision
+	return b.runWith(ctx, hashedIdentifier, &d, b.guard(b.cache, hashedIdentifier, func() (time.Duration, error) {
+		return b.allow(threshold, hashedIdentifier, &d.used)
+	}))
+}
+
+func (b *LeakyBucket) allow(threshold time.Duration, hashedIdentifier string, used *float64) (time.Duration, error) {
+	if threshold <= 0 {
+		return 0, ErrInvalidThreshold
+	}
+	for {
+		now := b.clock.Now()
+		var previous interface{}
+		item := leakyItem{lastLeak: now}
+		value, found, err := getErr(b.cache, hashedIdentifier)
+		if err != nil {
+			return b.handleReadError(err)
+		}
+		if found {
+			stored, ok := decodeLeakyItem(value)
+			if ok {
+				b.hit()
+				previous = value
+				item = stored
+			} else if err := b.handleInvalidValue(value); err != nil {
+				return 0, err
+			} else {
+				previous = replace
+			}
+		} else {
+			b.miss()
+		}
+
+		// the bucket drains one call per threshold since the last call
+		level := item.level - float64(elapsed(now, item.lastLeak))/float64(threshold)
+		if level < 0 {
+			level = 0
+		}
+		if level >= float64(b.capacity) {
+			return 0, ErrBucketFull
+		}
+
+		delay := time.Duration(level * float64(threshold))
+		if delay > b.timeout {
+			return delay, deadlineExceeded(hashedIdentifier, delay, b.timeout)
+		}
+
+		next := leakyItem{level: level + 1, lastLeak: now}
+		expiry := time.Duration(next.level * float64(threshold))
+		ok, err := update(b.cache, hashedIdentifier, previous, next, expiry)
+		if err != nil {
+			return b.handleCacheError(err)
+		}
+		if !ok {
+			continue
+		}
+		reportUsage(used, next.level/float64(b.capacity))
+		return delay, nil
+	}
+}
+
+// NewLeakyBucket creates a new LeakyBucket. `capacity` defines the number
+// of calls that can be queued for the same identifier before calls are
+// being rejected and must be positive.
+func NewLeakyBucket(capacity int, timeout time.Duration, cache GetSetter, opts ...Option) (*LeakyBucket, error) {
+	if capacity < 1 {
+		return nil, errors.New("ratelimiter: capacity must be positive")
+	}
+	o, err := newOptions(append([]Option{WithTimeout(timeout)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &LeakyBucket{
+		options:  o,
+		capacity: capacity,
+		cache:    cache,
+	}, nil
+}
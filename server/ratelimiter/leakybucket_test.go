@@ -0,0 +1,47 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestLeakyBucket_allow(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	bucket, _ := NewLeakyBucket(2, time.Hour, &mockGetSetter{}, WithClock(clock))
+	key := bucket.hash("leaky")
+
+	expected := []struct {
+		advance time.Duration
+		delay   time.Duration
+		err     error
+	}{
+		{0, 0, nil},
+		{0, time.Second, nil},
+		{0, 0, ErrBucketFull},
+		{time.Second, time.Second, nil},
+		{time.Second * 3, 0, nil},
+	}
+	for i, e := range expected {
+		clock.Advance(e.advance)
+		delay, err := bucket.allow(time.Second, key, nil)
+		if delay != e.delay || err != e.err {
+			t.Errorf("Call %d: expected %v, %v, got %v, %v", i, e.delay, e.err, delay, err)
+		}
+	}
+}
+
+func TestLeakyBucket_LinearThrottle(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	bucket, _ := NewLeakyBucket(1, time.Hour, &mockGetSetter{}, WithClock(clock))
+	if result := <-bucket.LinearThrottle(time.Minute, "leaky"); result.Error != nil || result.Delay != 0 {
+		t.Errorf("Unexpected result %v", result)
+	}
+	if result := <-bucket.LinearThrottle(time.Minute, "leaky"); result.Error != ErrBucketFull {
+		t.Errorf("Expected %v, got %v", ErrBucketFull, result.Error)
+	}
+}
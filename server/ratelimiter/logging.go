@@ -0,0 +1,63 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"time"
+)
+
+// Logging wraps the given Throttler so that the outcome of each call is
+// passed to logf together with the identifier and the wall-clock time the
+// caller has been blocked for. As identifiers are logged as is, callers
+// should make sure they do not leak personal data into logs.
+func Logging(next Throttler, logf func(format string, args ...interface{})) Throttler {
+	return &logging{next: next, logf: logf}
+}
+
+type logging struct {
+	next Throttler
+	logf func(format string, args ...interface{})
+}
+
+func (l *logging) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return l.log("linear", identifier, l.next.LinearThrottle(threshold, identifier))
+}
+
+func (l *logging) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return l.log("exponential", identifier, l.next.ExponentialThrottle(threshold, identifier))
+}
+
+func (l *logging) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return l.log("linear", identifier, LinearThrottleCtx(ctx, l.next, threshold, identifier))
+}
+
+func (l *logging) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return l.log("exponential", identifier, ExponentialThrottleCtx(ctx, l.next, threshold, identifier))
+}
+
+// Close closes the wrapped Throttler in case it implements Closer.
+func (l *logging) Close(ctx context.Context) error {
+	if c, ok := l.next.(Closer); ok {
+		return c.Close(ctx)
+	}
+	return nil
+}
+
+func (l *logging) log(kind, identifier string, in <-chan Result) <-chan Result {
+	start := time.Now()
+	out := make(chan Result, 1)
+	go func() {
+		defer close(out)
+		result := <-in
+		blocked := time.Since(start)
+		if result.Error != nil {
+			l.logf("ratelimiter: %s throttle of %q failed after %v: %v", kind, identifier, blocked, result.Error)
+		} else {
+			l.logf("ratelimiter: %s throttle of %q allowed after %v with delay %v", kind, identifier, blocked, result.Delay)
+		}
+		out <- result
+	}()
+	return out
+}
@@ -0,0 +1,38 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogging(t *testing.T) {
+	var lock sync.Mutex
+	var lines []string
+	logf := func(format string, args ...interface{}) {
+		lock.Lock()
+		defer lock.Unlock()
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	limiter, _ := NewLimiter(time.Millisecond*20, &mockGetSetter{})
+	throttler := Logging(limiter, logf)
+
+	<-throttler.LinearThrottle(time.Millisecond*50, "logging")
+	<-ExponentialThrottleCtx(context.Background(), throttler, time.Millisecond*50, "logging")
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got %d", len(lines))
+	}
+	if !strings.Contains(lines[0], `"logging" allowed`) {
+		t.Errorf("Unexpected log line %s", lines[0])
+	}
+	if !strings.Contains(lines[1], ErrWouldExceedDeadline.Error()) {
+		t.Errorf("Unexpected log line %s", lines[1])
+	}
+}
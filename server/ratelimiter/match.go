@@ -0,0 +1,94 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+var (
+	errEnumerateUnsupported = errors.New("ratelimiter: cache does not support enumerating keys")
+	errKeyIndexMissing      = errors.New("ratelimiter: matching identifiers requires WithKeyIndex or WithPlaintextKeys")
+)
+
+// WithKeyIndex makes the throttler remember the identifier each hashed key
+// has been created from, which is required for using ResetMatching on
+// hashed keys. The index is kept in memory, so it only covers identifiers
+// that have been used with this instance, and it grows with the number of
+// distinct identifiers until entries are pruned by ResetMatching.
+func WithKeyIndex() Option {
+	return func(o *options) {
+		o.keyIndex = &sync.Map{}
+	}
+}
+
+// index records the identifier the given key has been hashed from.
+func (o *options) index(key, identifier string) {
+	if o.keyIndex == nil {
+		return
+	}
+	if _, ok := o.keyIndex.Load(key); !ok {
+		o.keyIndex.Store(key, identifier)
+	}
+}
+
+// identifier returns the identifier the given key has been created from.
+func (o *options) identifier(key string) (string, bool) {
+	if o.plaintextKeys {
+		return o.owns(key)
+	}
+	if o.keyIndex == nil {
+		return "", false
+	}
+	identifier, ok := o.keyIndex.Load(key)
+	if !ok {
+		return "", false
+	}
+	return identifier.(string), true
+}
+
+// ResetMatching removes any limit and circuit breaker state stored for all
+// identifiers starting with the given prefix, e.g. all identifiers of a
+// tenant. Identifiers are matched after applying WithKeyNormalizer. As
+// keys are hashed, this requires the Limiter to be created using
+// WithKeyIndex or WithPlaintextKeys, and only identifiers known to the index
+// of this instance are matched. It returns an error in case the underlying
+// cache does not implement Enumerator and Deleter.
+func (l *Limiter) ResetMatching(prefix string) error {
+	e, ok := l.cache.(Enumerator)
+	if !ok {
+		return errEnumerateUnsupported
+	}
+	d, ok := l.cache.(Deleter)
+	if !ok {
+		return errDeleteUnsupported
+	}
+	if !l.plaintextKeys && l.keyIndex == nil {
+		return errKeyIndexMissing
+	}
+
+	stored := map[string]bool{}
+	for _, key := range e.Keys() {
+		stored[key] = true
+		identifier, ok := l.identifier(key)
+		if !ok || !strings.HasPrefix(identifier, prefix) {
+			continue
+		}
+		d.Delete(key)
+		d.Delete(breakerKey(key))
+	}
+	if l.keyIndex != nil {
+		// identifiers whose limits have expired are dropped from the
+		// index, so it does not grow indefinitely
+		l.keyIndex.Range(func(key, identifier interface{}) bool {
+			if !stored[key.(string)] || strings.HasPrefix(identifier.(string), prefix) {
+				l.keyIndex.Delete(key)
+			}
+			return true
+		})
+	}
+	return nil
+}
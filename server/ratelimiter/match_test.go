@@ -0,0 +1,64 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/memory"
+)
+
+func TestLimiter_ResetMatching(t *testing.T) {
+	tests := []struct {
+		name          string
+		cache         GetSetter
+		opts          []Option
+		expectedError error
+	}{
+		{"key index", memory.NewCache(time.Minute), []Option{WithKeyIndex()}, nil},
+		{"plaintext keys", memory.NewCache(time.Minute), []Option{WithPlaintextKeys()}, nil},
+		{"no index", memory.NewCache(time.Minute), nil, errKeyIndexMissing},
+		{"no enumeration", &mockGetSetter{}, []Option{WithKeyIndex()}, errEnumerateUnsupported},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter, _ := NewLimiter(time.Millisecond, test.cache, test.opts...)
+			for _, identifier := range []string{"tenant-a:1", "tenant-a:2", "tenant-b:1"} {
+				limiter.LinearAllow(time.Minute, identifier)
+			}
+
+			err := limiter.ResetMatching("tenant-a:")
+			if err != test.expectedError {
+				t.Errorf("Expected %v, got %v", test.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			for identifier, expected := range map[string]bool{"tenant-a:1": false, "tenant-a:2": false, "tenant-b:1": true} {
+				if _, limited := limiter.Peek(identifier); limited != expected {
+					t.Errorf("Expected %v for %s, got %v", expected, identifier, limited)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiter_ResetMatchingNamespace(t *testing.T) {
+	cache := memory.NewCache(time.Minute)
+	a, _ := NewLimiter(time.Millisecond, cache, WithPlaintextKeys(), WithNamespace("a"))
+	b, _ := NewLimiter(time.Millisecond, cache, WithPlaintextKeys(), WithNamespace("b"))
+	a.LinearAllow(time.Minute, "tenant-a:1")
+	b.LinearAllow(time.Minute, "tenant-a:1")
+
+	if err := a.ResetMatching("tenant-a:"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if _, limited := a.Peek("tenant-a:1"); limited {
+		t.Error("Expected limit to be reset")
+	}
+	if _, limited := b.Peek("tenant-a:1"); !limited {
+		t.Error("Expected limit in other namespace to be kept")
+	}
+}
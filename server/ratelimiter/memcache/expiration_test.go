@@ -0,0 +1,31 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package memcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiration(t *testing.T) {
+	tests := []struct {
+		expiry   time.Duration
+		expected int32
+	}{
+		{0, 1},
+		{-time.Second, 1},
+		{time.Millisecond, 1},
+		{time.Second, 1},
+		{time.Second + time.Millisecond, 2},
+		{time.Hour, 3600},
+	}
+	for _, test := range tests {
+		if result := expiration(test.expiry); result != test.expected {
+			t.Errorf("Expected %d for %v, got %d", test.expected, test.expiry, result)
+		}
+	}
+	if result := expiration(time.Hour * 24 * 31); int64(result) <= time.Now().Unix() {
+		t.Errorf("Expected long expiry to be converted to a timestamp, got %d", result)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package memcache provides a ratelimiter.GetSetter that stores limits in
+// memcached, allowing multiple instances to share limits. Instances sharing
+// a cache need to use the same salt (see ratelimiter.WithSalt).
+package memcache
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+var errUnsupportedValue = errors.New("memcache: value does not implement encoding.BinaryMarshaler")
+
+// Cache implements ratelimiter.GetSetter, ratelimiter.GetErrer,
+// ratelimiter.SetErrer, ratelimiter.Adder, ratelimiter.CompareAndSwapper,
+// ratelimiter.Deleter and ratelimiter.Pinger using memcached. Values are
+// serialized using their encoding.BinaryMarshaler implementation and
+// returned as []byte when read. As stored limits are encoded values instead
+// of plain counters, updates use memcached's check-and-set instead of incr.
+type Cache struct {
+	client *memcache.Client
+}
+
+// Get returns the value stored for the given key. Errors talking to
+// memcached are treated like missing values, use GetErr for handling them.
+func (c *Cache) Get(key string) (interface{}, bool) {
+	value, found, _ := c.GetErr(key)
+	return value, found
+}
+
+// GetErr returns the value stored for the given key, returning an error in
+// case memcached cannot be reached.
+func (c *Cache) GetErr(key string) (interface{}, bool, error) {
+	item, err := c.client.Get(key)
+	if err == memcache.ErrCacheMiss {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("memcache: error getting value: %w", err)
+	}
+	return item.Value, true, nil
+}
+
+// Set stores the given value using the given expiry. Errors are skipped,
+// use SetErr for handling them.
+func (c *Cache) Set(key string, value interface{}, expiry time.Duration) {
+	c.SetErr(key, value, expiry)
+}
+
+// SetErr stores the given value using the given expiry, returning an error
+// in case the value cannot be serialized or stored.
+func (c *Cache) SetErr(key string, value interface{}, expiry time.Duration) error {
+	data, err := marshal(value)
+	if err != nil {
+		return err
+	}
+	if err := c.client.Set(&memcache.Item{Key: key, Value: data, Expiration: expiration(expiry)}); err != nil {
+		return fmt.Errorf("memcache: error setting value: %w", err)
+	}
+	return nil
+}
+
+// Add stores the given value using the given expiry in case no value is
+// stored for the given key yet.
+func (c *Cache) Add(key string, value interface{}, expiry time.Duration) (bool, error) {
+	data, err := marshal(value)
+	if err != nil {
+		return false, err
+	}
+	err = c.client.Add(&memcache.Item{Key: key, Value: data, Expiration: expiration(expiry)})
+	switch err {
+	case nil:
+		return true, nil
+	case memcache.ErrNotStored:
+		return false, nil
+	default:
+		return false, fmt.Errorf("memcache: error adding value: %w", err)
+	}
+}
+
+// CompareAndSwap atomically replaces the value stored for the given key in
+// case it still equals the given old value.
+func (c *Cache) CompareAndSwap(key string, old, new interface{}, expiry time.Duration) bool {
+	oldData, err := marshal(old)
+	if err != nil {
+		return false
+	}
+	newData, err := marshal(new)
+	if err != nil {
+		return false
+	}
+	item, err := c.client.Get(key)
+	if err != nil || !bytes.Equal(item.Value, oldData) {
+		return false
+	}
+	item.Value = newData
+	item.Expiration = expiration(expiry)
+	return c.client.CompareAndSwap(item) == nil
+}
+
+// Delete removes the value stored for the given key.
+func (c *Cache) Delete(key string) {
+	c.client.Delete(key)
+}
+
+// Ping checks whether memcached is reachable.
+func (c *Cache) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := c.client.Ping(); err != nil {
+		return fmt.Errorf("memcache: error pinging: %w", err)
+	}
+	return nil
+}
+
+func marshal(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case encoding.BinaryMarshaler:
+		return v.MarshalBinary()
+	default:
+		return nil, errUnsupportedValue
+	}
+}
+
+// maxRelativeExpiration is the longest expiration memcached interprets
+// as relative to the current time. Longer expirations are interpreted as
+// Unix timestamps.
+const maxRelativeExpiration = 60 * 60 * 24 * 30
+
+// expiration converts the given expiry into memcached's expiration in
+// seconds. As zero means that values never expire, expiries are rounded up
+// to at least one second.
+func expiration(expiry time.Duration) int32 {
+	seconds := int64((expiry + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+	if seconds > maxRelativeExpiration {
+		return int32(time.Now().Unix() + seconds)
+	}
+	return int32(seconds)
+}
+
+// New creates a new Cache using the given client.
+func New(client *memcache.Client) *Cache {
+	return &Cache{client: client}
+}
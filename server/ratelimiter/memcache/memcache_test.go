@@ -0,0 +1,84 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build memcache
+// +build memcache
+
+package memcache
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+func newTestCache(t *testing.T) *Cache {
+	addr := os.Getenv("MEMCACHE_ADDR")
+	if addr == "" {
+		addr = "localhost:11211"
+	}
+	client := memcache.New(addr)
+	if err := client.DeleteAll(); err != nil {
+		t.Fatalf("Error connecting to memcached at %s: %v", addr, err)
+	}
+	return New(client)
+}
+
+type binaryValue string
+
+func (b binaryValue) MarshalBinary() ([]byte, error) {
+	return []byte(b), nil
+}
+
+func TestCache(t *testing.T) {
+	cache := newTestCache(t)
+
+	if _, found := cache.Get("key"); found {
+		t.Error("Unexpected value for unknown key")
+	}
+	if ok, err := cache.Add("key", binaryValue("value"), time.Second); !ok || err != nil {
+		t.Errorf("Expected value to be added, got %v, %v", ok, err)
+	}
+	if ok, err := cache.Add("key", binaryValue("other"), time.Second); ok || err != nil {
+		t.Errorf("Expected existing value to be kept, got %v, %v", ok, err)
+	}
+	if value, found := cache.Get("key"); !found || string(value.([]byte)) != "value" {
+		t.Errorf("Unexpected value %v", value)
+	}
+
+	if cache.CompareAndSwap("key", binaryValue("other"), binaryValue("next"), time.Second) {
+		t.Error("Unexpected swap of non-matching value")
+	}
+	if !cache.CompareAndSwap("key", []byte("value"), binaryValue("next"), time.Second) {
+		t.Error("Expected swap of matching value")
+	}
+	if value, _ := cache.Get("key"); string(value.([]byte)) != "next" {
+		t.Errorf("Unexpected value %v", value)
+	}
+
+	cache.Delete("key")
+	if _, found := cache.Get("key"); found {
+		t.Error("Expected value to be deleted")
+	}
+	if err := cache.Ping(context.Background()); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestCache_Limiter(t *testing.T) {
+	cache := newTestCache(t)
+	salt := ratelimiter.WithSalt([]byte("salt"))
+	a, _ := ratelimiter.NewLimiter(time.Hour, cache, salt)
+	b, _ := ratelimiter.NewLimiter(time.Hour, cache, salt)
+
+	if result := <-a.LinearThrottle(time.Millisecond*100, "shared"); result.Error != nil || result.Delay != 0 {
+		t.Errorf("Unexpected result %v", result)
+	}
+	if result := <-b.LinearThrottle(time.Millisecond*100, "shared"); result.Error != nil || result.Delay == 0 {
+		t.Errorf("Expected limit to be shared across limiters, got %v", result)
+	}
+}
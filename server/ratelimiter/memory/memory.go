@@ -0,0 +1,174 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package memory provides an in-memory ratelimiter.GetSetter for use in
+// single-instance deployments.
+package memory
+
+import (
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/offen/offen/server/ratelimiter/internal/value"
+)
+
+// Cache is a thread-safe in-memory cache implementing
+// ratelimiter.GetSetter, ratelimiter.CompareAndSwapper, ratelimiter.Adder,
+// ratelimiter.Deleter, ratelimiter.Enumerator, ratelimiter.Lener and
+// ratelimiter.Sizer. Reads are lock-free while writes are serialized.
+// Expired values are never returned and are removed by a background
+// sweeper. The zero value is an empty cache without a sweeper, use
+// NewCache for creating a cache that removes expired values.
+type Cache struct {
+	values sync.Map
+	lock   sync.Mutex
+	done   chan struct{}
+	once   sync.Once
+}
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !now.Before(e.expires)
+}
+
+func (c *Cache) load(key string) (*entry, bool) {
+	v, ok := c.values.Load(key)
+	if !ok {
+		return nil, false
+	}
+	e := v.(*entry)
+	if e.expired(time.Now()) {
+		return nil, false
+	}
+	return e, true
+}
+
+// Get returns the value stored for the given key in case it exists and
+// has not expired yet.
+func (c *Cache) Get(key string) (interface{}, bool) {
+	e, ok := c.load(key)
+	if !ok {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Set stores the given value for the given duration. Values stored using a
+// non-positive expiry are considered expired immediately.
+func (c *Cache) Set(key string, value interface{}, expiry time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.values.Store(key, &entry{value: value, expires: time.Now().Add(expiry)})
+}
+
+// Add stores the given value for the given duration in case no value is
+// stored for the given key yet.
+func (c *Cache) Add(key string, value interface{}, expiry time.Duration) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.load(key); ok {
+		return false, nil
+	}
+	c.values.Store(key, &entry{value: value, expires: time.Now().Add(expiry)})
+	return true, nil
+}
+
+// CompareAndSwap replaces the value stored for the given key in case it
+// exists and equals the given old value.
+func (c *Cache) CompareAndSwap(key string, old, new interface{}, expiry time.Duration) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	e, ok := c.load(key)
+	if !ok || !value.Equal(e.value, old) {
+		return false
+	}
+	c.values.Store(key, &entry{value: new, expires: time.Now().Add(expiry)})
+	return true
+}
+
+// Delete removes the value stored for the given key.
+func (c *Cache) Delete(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.values.Delete(key)
+}
+
+// Len returns the number of values currently stored.
+func (c *Cache) Len() int {
+	return len(c.Keys())
+}
+
+// Keys returns the keys of all values currently stored.
+func (c *Cache) Keys() []string {
+	now := time.Now()
+	var keys []string
+	c.values.Range(func(key, value interface{}) bool {
+		if !value.(*entry).expired(now) {
+			keys = append(keys, key.(string))
+		}
+		return true
+	})
+	return keys
+}
+
+// ApproximateSize returns an estimate of the memory occupied by the
+// stored keys and entries in bytes. Memory referenced by values is
+// not included.
+func (c *Cache) ApproximateSize() int {
+	size := 0
+	for _, key := range c.Keys() {
+		size += len(key) + int(unsafe.Sizeof(entry{}))
+	}
+	return size
+}
+
+func (c *Cache) sweep() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	c.values.Range(func(key, value interface{}) bool {
+		if value.(*entry).expired(now) {
+			c.values.Delete(key)
+		}
+		return true
+	})
+}
+
+// Close stops the background sweeper. The cache can still be used
+// afterwards, but expired values will not be removed anymore.
+func (c *Cache) Close() {
+	c.once.Do(func() {
+		// caches that have not been created using NewCache do not
+		// run a sweeper
+		if c.done != nil {
+			close(c.done)
+		}
+	})
+}
+
+// NewCache creates a new Cache that removes expired values every
+// `cleanupInterval`. Passing a non-positive interval disables the
+// background sweeper.
+func NewCache(cleanupInterval time.Duration) *Cache {
+	c := &Cache{done: make(chan struct{})}
+	if cleanupInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(cleanupInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					c.sweep()
+				case <-c.done:
+					return
+				}
+			}
+		}()
+	}
+	return c
+}
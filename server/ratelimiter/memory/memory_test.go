@@ -0,0 +1,102 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+var (
+	_ ratelimiter.GetSetter         = &Cache{}
+	_ ratelimiter.CompareAndSwapper = &Cache{}
+	_ ratelimiter.Adder             = &Cache{}
+	_ ratelimiter.Deleter           = &Cache{}
+	_ ratelimiter.Enumerator        = &Cache{}
+	_ ratelimiter.Lener             = &Cache{}
+	_ ratelimiter.Sizer             = &Cache{}
+)
+
+func TestCache(t *testing.T) {
+	c := NewCache(0)
+	defer c.Close()
+
+	if _, found := c.Get("key"); found {
+		t.Error("Unexpected value for unknown key")
+	}
+
+	c.Set("key", "value", time.Millisecond*50)
+	if value, found := c.Get("key"); !found || value != "value" {
+		t.Errorf("Unexpected value %v", value)
+	}
+
+	if c.CompareAndSwap("key", "other", "next", time.Millisecond*50) {
+		t.Error("Unexpected swap of non-matching value")
+	}
+	if !c.CompareAndSwap("key", "value", "next", time.Millisecond*50) {
+		t.Error("Expected swap of matching value")
+	}
+	if value, _ := c.Get("key"); value != "next" {
+		t.Errorf("Unexpected value %v", value)
+	}
+
+	time.Sleep(time.Millisecond * 60)
+	if _, found := c.Get("key"); found {
+		t.Error("Expected value to be expired")
+	}
+	if c.CompareAndSwap("key", "next", "other", time.Second) {
+		t.Error("Unexpected swap of expired value")
+	}
+
+	if ok, _ := c.Add("key", "value", time.Minute); !ok {
+		t.Error("Expected value to be added for expired key")
+	}
+	if ok, _ := c.Add("key", "other", time.Minute); ok {
+		t.Error("Unexpected add for existing key")
+	}
+	c.Delete("key")
+	if _, found := c.Get("key"); found {
+		t.Error("Expected value to be deleted")
+	}
+}
+
+func TestCache_Sweep(t *testing.T) {
+	c := NewCache(time.Millisecond * 10)
+	defer c.Close()
+
+	c.Set("key", "value", time.Millisecond)
+	time.Sleep(time.Millisecond * 50)
+	if _, ok := c.values.Load("key"); ok {
+		t.Error("Expected expired value to be removed by sweeper")
+	}
+}
+
+func TestCache_ZeroValue(t *testing.T) {
+	var c Cache
+	c.Set("key", "value", time.Minute)
+	if value, ok := c.Get("key"); !ok || value != "value" {
+		t.Errorf("Expected %v, got %v", "value", value)
+	}
+	c.Close()
+	c.Close()
+}
+
+func TestCache_Keys(t *testing.T) {
+	c := NewCache(0)
+	defer c.Close()
+
+	c.Set("a", "value", time.Minute)
+	c.Set("b", "value", 0)
+	if keys := c.Keys(); len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+	if l := c.Len(); l != 1 {
+		t.Errorf("Expected length of 1, got %d", l)
+	}
+	if size := c.ApproximateSize(); size <= 0 {
+		t.Errorf("Expected positive size, got %d", size)
+	}
+}
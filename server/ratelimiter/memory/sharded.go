@@ -0,0 +1,121 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package memory
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// ShardedCache distributes keys across a fixed number of Cache shards, each
+// serializing its writes independently, so concurrent writes for different
+// keys do not contend for the same lock. It implements the same interfaces
+// as Cache.
+type ShardedCache struct {
+	shards []*Cache
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (s *ShardedCache) shard(key string) *Cache {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// Get returns the value stored for the given key in case it exists and
+// has not expired yet.
+func (s *ShardedCache) Get(key string) (interface{}, bool) {
+	return s.shard(key).Get(key)
+}
+
+// Set stores the given value for the given duration. Values stored using a
+// non-positive expiry are considered expired immediately.
+func (s *ShardedCache) Set(key string, value interface{}, expiry time.Duration) {
+	s.shard(key).Set(key, value, expiry)
+}
+
+// Add stores the given value for the given duration in case no value is
+// stored for the given key yet.
+func (s *ShardedCache) Add(key string, value interface{}, expiry time.Duration) (bool, error) {
+	return s.shard(key).Add(key, value, expiry)
+}
+
+// CompareAndSwap replaces the value stored for the given key in case it
+// exists and equals the given old value.
+func (s *ShardedCache) CompareAndSwap(key string, old, new interface{}, expiry time.Duration) bool {
+	return s.shard(key).CompareAndSwap(key, old, new, expiry)
+}
+
+// Delete removes the value stored for the given key.
+func (s *ShardedCache) Delete(key string) {
+	s.shard(key).Delete(key)
+}
+
+// Len returns the number of values currently stored.
+func (s *ShardedCache) Len() int {
+	l := 0
+	for _, shard := range s.shards {
+		l += shard.Len()
+	}
+	return l
+}
+
+// Keys returns the keys of all values currently stored.
+func (s *ShardedCache) Keys() []string {
+	var keys []string
+	for _, shard := range s.shards {
+		keys = append(keys, shard.Keys()...)
+	}
+	return keys
+}
+
+// ApproximateSize returns an estimate of the memory occupied by the
+// stored keys and entries in bytes.
+func (s *ShardedCache) ApproximateSize() int {
+	size := 0
+	for _, shard := range s.shards {
+		size += shard.ApproximateSize()
+	}
+	return size
+}
+
+// Close stops the background sweeper.
+func (s *ShardedCache) Close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+// NewShardedCache creates a new ShardedCache using the given number of
+// shards that removes expired values every `cleanupInterval`. Passing a
+// non-positive interval disables the background sweeper. At least one
+// shard is always used.
+func NewShardedCache(shards int, cleanupInterval time.Duration) *ShardedCache {
+	if shards < 1 {
+		shards = 1
+	}
+	s := &ShardedCache{done: make(chan struct{})}
+	for i := 0; i < shards; i++ {
+		s.shards = append(s.shards, NewCache(0))
+	}
+	if cleanupInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(cleanupInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					for _, shard := range s.shards {
+						shard.sweep()
+					}
+				case <-s.done:
+					return
+				}
+			}
+		}()
+	}
+	return s
+}
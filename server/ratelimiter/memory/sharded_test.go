@@ -0,0 +1,78 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package memory
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+var (
+	_ ratelimiter.GetSetter         = &ShardedCache{}
+	_ ratelimiter.CompareAndSwapper = &ShardedCache{}
+	_ ratelimiter.Adder             = &ShardedCache{}
+	_ ratelimiter.Deleter           = &ShardedCache{}
+	_ ratelimiter.Enumerator        = &ShardedCache{}
+	_ ratelimiter.Lener             = &ShardedCache{}
+	_ ratelimiter.Sizer             = &ShardedCache{}
+)
+
+func TestShardedCache(t *testing.T) {
+	c := NewShardedCache(4, time.Millisecond*10)
+	defer c.Close()
+
+	for i := 0; i < 10; i++ {
+		c.Set(fmt.Sprintf("key-%d", i), i, time.Minute)
+	}
+	c.Set("expired", "value", time.Millisecond)
+	if l := c.Len(); l != 10 && l != 11 {
+		t.Errorf("Unexpected length %d", l)
+	}
+	if value, found := c.Get("key-3"); !found || value != 3 {
+		t.Errorf("Unexpected value %v", value)
+	}
+	if !c.CompareAndSwap("key-3", 3, 4, time.Minute) {
+		t.Error("Expected swap of matching value")
+	}
+	c.Delete("key-4")
+	if _, found := c.Get("key-4"); found {
+		t.Error("Expected value to be deleted")
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	if _, ok := c.shard("expired").values.Load("expired"); ok {
+		t.Error("Expected expired value to be removed by sweeper")
+	}
+	if keys := c.Keys(); len(keys) != 9 {
+		t.Errorf("Expected 9 keys, got %v", keys)
+	}
+}
+
+func BenchmarkCache(b *testing.B) {
+	b.Run("single lock", func(b *testing.B) {
+		c := NewCache(0)
+		defer c.Close()
+		benchmarkConcurrentThrottle(b, c)
+	})
+	b.Run("sharded", func(b *testing.B) {
+		c := NewShardedCache(32, 0)
+		defer c.Close()
+		benchmarkConcurrentThrottle(b, c)
+	})
+}
+
+func benchmarkConcurrentThrottle(b *testing.B, cache ratelimiter.GetSetter) {
+	limiter, _ := ratelimiter.NewLimiter(time.Hour, cache)
+	var counter int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := atomic.AddInt64(&counter, 1)
+			limiter.LinearAllow(time.Nanosecond, fmt.Sprintf("identifier-%d", i%1024))
+		}
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package memory
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type snapshotEntry struct {
+	Key     string    `json:"key"`
+	Value   []byte    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+func (c *Cache) snapshot() ([]snapshotEntry, error) {
+	now := time.Now()
+	var entries []snapshotEntry
+	var err error
+	c.values.Range(func(key, value interface{}) bool {
+		e := value.(*entry)
+		if e.expired(now) {
+			return true
+		}
+		var data []byte
+		switch v := e.value.(type) {
+		case []byte:
+			data = v
+		case encoding.BinaryMarshaler:
+			if data, err = v.MarshalBinary(); err != nil {
+				return false
+			}
+		default:
+			err = fmt.Errorf("memory: cannot export value of type %T", e.value)
+			return false
+		}
+		entries = append(entries, snapshotEntry{Key: key.(string), Value: data, Expires: e.expires})
+		return true
+	})
+	return entries, err
+}
+
+func (c *Cache) restore(entries []snapshotEntry) {
+	now := time.Now()
+	for _, e := range entries {
+		if expiry := e.Expires.Sub(now); expiry > 0 {
+			c.Set(e.Key, e.Value, expiry)
+		}
+	}
+}
+
+// Export serializes all values that have not expired yet alongside their
+// expiry so they can be restored after a restart using Import. Values
+// are required to be []byte or implement encoding.BinaryMarshaler, which
+// is the case for all values stored by the throttlers in package
+// ratelimiter.
+func (c *Cache) Export() ([]byte, error) {
+	entries, err := c.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(entries)
+}
+
+// Import restores values previously serialized using Export. Values are
+// restored as []byte using their remaining expiry, values that have expired
+// in the meantime are skipped.
+func (c *Cache) Import(data []byte) error {
+	var entries []snapshotEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("memory: error decoding snapshot: %w", err)
+	}
+	c.restore(entries)
+	return nil
+}
+
+// Export serializes all values that have not expired yet alongside their
+// expiry so they can be restored after a restart using Import.
+func (s *ShardedCache) Export() ([]byte, error) {
+	var entries []snapshotEntry
+	for _, shard := range s.shards {
+		shardEntries, err := shard.snapshot()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, shardEntries...)
+	}
+	return json.Marshal(entries)
+}
+
+// Import restores values previously serialized using Export, skipping
+// values that have expired in the meantime.
+func (s *ShardedCache) Import(data []byte) error {
+	var entries []snapshotEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("memory: error decoding snapshot: %w", err)
+	}
+	for _, e := range entries {
+		s.shard(e.Key).restore([]snapshotEntry{e})
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+func TestCache_ExportImport(t *testing.T) {
+	tests := []struct {
+		name   string
+		source interface {
+			ratelimiter.GetSetter
+			Export() ([]byte, error)
+		}
+		target interface {
+			ratelimiter.GetSetter
+			Import([]byte) error
+		}
+	}{
+		{"cache", NewCache(0), NewCache(0)},
+		{"sharded", NewShardedCache(4, 0), NewShardedCache(8, 0)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source, _ := ratelimiter.NewLimiter(time.Hour, test.source, ratelimiter.WithSalt([]byte("salt")))
+			<-source.LinearThrottle(time.Minute, "export")
+			test.source.Set("expiring", []byte("value"), time.Millisecond*10)
+
+			data, err := test.source.Export()
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			time.Sleep(time.Millisecond * 20)
+			if err := test.target.Import(data); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+
+			if _, found := test.target.Get("expiring"); found {
+				t.Error("Expected expired value to be skipped")
+			}
+			target, _ := ratelimiter.NewLimiter(time.Hour, test.target, ratelimiter.WithSalt([]byte("salt")))
+			if _, limited := target.Peek("export"); !limited {
+				t.Error("Expected limit to be restored")
+			}
+
+			throttling, _ := ratelimiter.NewLimiter(time.Hour, test.target, ratelimiter.WithSalt([]byte("salt")), ratelimiter.WithNonBlocking())
+			result := <-throttling.LinearThrottle(time.Minute, "export")
+			if result.Error != nil {
+				t.Errorf("Unexpected error %v", result.Error)
+			}
+			if !result.Deferred {
+				t.Error("Expected restored limit to defer call")
+			}
+		})
+	}
+}
+
+func TestCache_Export(t *testing.T) {
+	c := NewCache(0)
+	c.Set("key", struct{}{}, time.Minute)
+	if _, err := c.Export(); err == nil {
+		t.Error("Expected error exporting unsupported value")
+	}
+	if err := c.Import([]byte("not json")); err == nil {
+		t.Error("Expected error importing invalid data")
+	}
+}
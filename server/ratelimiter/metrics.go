@@ -0,0 +1,51 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"sync/atomic"
+)
+
+// Metrics counts how often a throttler found limits in its cache when
+// deciding on calls, e.g. for diagnosing a cache that loses values
+// unexpectedly, which results in a high number of misses, or values
+// getting corrupted.
+type Metrics struct {
+	// Hits is the number of lookups that found a valid value.
+	Hits uint64
+	// Misses is the number of lookups that did not find a value or found
+	// a value using an unknown encoding version.
+	Misses uint64
+	// Invalid is the number of lookups that found a value that cannot be
+	// decoded.
+	Invalid uint64
+}
+
+type metrics struct {
+	hits    uint64
+	misses  uint64
+	invalid uint64
+}
+
+// Metrics returns the number of cache lookups made by the throttler since
+// it has been created.
+func (o *options) Metrics() Metrics {
+	return Metrics{
+		Hits:    atomic.LoadUint64(&o.metrics.hits),
+		Misses:  atomic.LoadUint64(&o.metrics.misses),
+		Invalid: atomic.LoadUint64(&o.metrics.invalid),
+	}
+}
+
+func (o *options) hit() {
+	atomic.AddUint64(&o.metrics.hits, 1)
+}
+
+func (o *options) miss() {
+	atomic.AddUint64(&o.metrics.misses, 1)
+}
+
+func (o *options) corrupt() {
+	atomic.AddUint64(&o.metrics.invalid, 1)
+}
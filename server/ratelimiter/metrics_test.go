@@ -0,0 +1,40 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	for name, constructor := range constructors {
+		t.Run(name, func(t *testing.T) {
+			cache := &mockGetSetter{}
+			throttler := constructor(cache)
+			type metered interface {
+				Metrics() Metrics
+				hash(string) string
+			}
+			m := throttler.(metered)
+			// calls that are delayed return as soon as the decision
+			// has been made
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			<-LinearThrottleCtx(ctx, throttler, time.Minute, "id")
+			<-LinearThrottleCtx(ctx, throttler, time.Minute, "id")
+			cache.Set(m.hash("corrupt"), []byte("{}}"), time.Hour)
+			<-LinearThrottleCtx(ctx, throttler, time.Minute, "corrupt")
+			cache.Set(m.hash("future"), []byte{0x07, '{', '}'}, time.Hour)
+			<-LinearThrottleCtx(ctx, throttler, time.Minute, "future")
+
+			expected := Metrics{Hits: 1, Misses: 2, Invalid: 1}
+			if metrics := m.Metrics(); metrics != expected {
+				t.Errorf("Expected %v, got %v", expected, metrics)
+			}
+		})
+	}
+}
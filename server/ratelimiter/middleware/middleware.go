@@ -0,0 +1,152 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package middleware provides HTTP middleware for rate limiting requests
+// using a ratelimiter.Throttler.
+package middleware
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+// Handler returns middleware that throttles each request using the key
+// returned by keyFunc, which allows rate limiting by e.g. IP address, API
+// token or header value. Requests that are rejected use the status
+// returned by HTTPStatus. Responses using 429 or 503 set a Retry-After
+// header, just like responses using 403 for identifiers that are blocked
+// until a known time.
+//
+// In case the throttler implements ratelimiter.Configurable, a
+// RateLimit-Limit header is set on all responses. Throttlers implementing
+// ratelimiter.Remainer or that can peek at the state of an identifier like
+// ratelimiter.Limiter additionally set RateLimit-Remaining and
+// RateLimit-Reset headers as described in
+// draft-ietf-httpapi-ratelimit-headers. Throttlers
+// implementing ratelimiter.PolicyDescriber set a RateLimit-Policy header.
+func Handler(t ratelimiter.Throttler, threshold time.Duration, keyFunc func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ThrottleHTTP(t, threshold, w, r, keyFunc) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// ThrottleHTTP throttles the given request just like Handler does, for
+// handlers that want to throttle inline instead of using middleware. In case
+// the request is rejected, a response is written to w and false is
+// returned. Otherwise it returns true and the caller is expected to proceed
+// handling the request.
+func ThrottleHTTP(t ratelimiter.Throttler, threshold time.Duration, w http.ResponseWriter, r *http.Request, keyFunc func(*http.Request) string) bool {
+	key := keyFunc(r)
+	result := <-ratelimiter.LinearThrottleCtx(r.Context(), t, threshold, key)
+	setRateLimitHeaders(w, t, threshold, key)
+	if result.Error != nil {
+		status := HTTPStatus(result.Error)
+		if canRetry(status, result.Error) {
+			w.Header().Set("Retry-After", retryAfter(result.Delay))
+		}
+		http.Error(w, http.StatusText(status), status)
+		return false
+	}
+	return true
+}
+
+// HTTPStatus returns the HTTP status code a response rejected because of
+// the given error returned by a ratelimiter.Throttler should use. Calls
+// that are limited in any way map to 429, calls using a blocked identifier
+// map to 403 and calls made after closing the throttler map to 503. Calls
+// whose context is cancelled or times out map to 499 and 504, just like
+// gRPC gateways do. All other errors, including ratelimiter.ErrInvalidCache,
+// map to 500.
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, ratelimiter.ErrWouldExceedDeadline),
+		errors.Is(err, ratelimiter.ErrBlockTooLong),
+		errors.Is(err, ratelimiter.ErrOpen),
+		errors.Is(err, ratelimiter.ErrBucketFull),
+		errors.Is(err, ratelimiter.ErrTooManyInflight),
+		errors.Is(err, ratelimiter.ErrTooManyConcurrent):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ratelimiter.ErrBlocked):
+		return http.StatusForbidden
+	case errors.Is(err, ratelimiter.ErrClosed):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// canRetry reports whether a response using the given status code and
+// caused by the given error tells the client when to retry. Blocked
+// identifiers can only retry in case the block ends at a known time.
+func canRetry(status int, err error) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusForbidden:
+		var blockedErr *ratelimiter.BlockedError
+		return errors.As(err, &blockedErr) && !blockedErr.Until.IsZero()
+	default:
+		return false
+	}
+}
+
+// statusClientClosedRequest is the non-standard status code used for
+// requests the client has cancelled.
+const statusClientClosedRequest = 499
+
+type peeker interface {
+	Peek(identifier string) (time.Duration, bool)
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, t ratelimiter.Throttler, threshold time.Duration, key string) {
+	if d, ok := t.(ratelimiter.PolicyDescriber); ok {
+		w.Header().Set("RateLimit-Policy", d.Policy(threshold).String())
+	}
+	c, ok := t.(ratelimiter.Configurable)
+	if !ok {
+		return
+	}
+	limit := c.Config().Limit
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(limit))
+
+	var remaining int
+	var reset time.Duration
+	switch p := t.(type) {
+	case ratelimiter.Remainer:
+		remaining, reset = p.Remaining(threshold, key)
+	case peeker:
+		var blocked bool
+		reset, blocked = p.Peek(key)
+		if !blocked {
+			remaining = limit
+		}
+	default:
+		return
+	}
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("RateLimit-Reset", strconv.FormatInt(int64(math.Ceil(reset.Seconds())), 10))
+}
+
+// retryAfter formats the given delay as a number of seconds, rounding up
+// so clients do not retry too early.
+func retryAfter(delay time.Duration) string {
+	seconds := int64(math.Ceil(delay.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
@@ -0,0 +1,258 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+type mockCache struct {
+	lock   sync.Mutex
+	values map[string]interface{}
+}
+
+func (m *mockCache) Get(key string) (interface{}, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	v, ok := m.values[key]
+	return v, ok
+}
+
+func (m *mockCache) Set(key string, value interface{}, expiry time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.values == nil {
+		m.values = map[string]interface{}{}
+	}
+	m.values[key] = value
+}
+
+func TestHandler(t *testing.T) {
+	limiter, _ := ratelimiter.NewLimiter(time.Second, &mockCache{})
+	handler := Handler(limiter, time.Minute, func(r *http.Request) string {
+		return r.Header.Get("X-Key")
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name               string
+		key                string
+		expectedStatus     int
+		expectedRetryAfter string
+		expectedRemaining  string
+		expectedReset      string
+	}{
+		{
+			"first call",
+			"a",
+			http.StatusNoContent,
+			"",
+			"0",
+			"60",
+		},
+		{
+			"throttled",
+			"a",
+			http.StatusTooManyRequests,
+			"60",
+			"0",
+			"60",
+		},
+		{
+			"other key",
+			"b",
+			http.StatusNoContent,
+			"",
+			"0",
+			"60",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("X-Key", test.key)
+			handler.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+			if h := w.Header().Get("Retry-After"); h != test.expectedRetryAfter {
+				t.Errorf("Expected Retry-After of %q, got %q", test.expectedRetryAfter, h)
+			}
+			if h := w.Header().Get("RateLimit-Limit"); h != "1" {
+				t.Errorf("Expected RateLimit-Limit of %q, got %q", "1", h)
+			}
+			if h := w.Header().Get("RateLimit-Remaining"); h != test.expectedRemaining {
+				t.Errorf("Expected RateLimit-Remaining of %q, got %q", test.expectedRemaining, h)
+			}
+			if h := w.Header().Get("RateLimit-Reset"); h != test.expectedReset {
+				t.Errorf("Expected RateLimit-Reset of %q, got %q", test.expectedReset, h)
+			}
+		})
+	}
+}
+
+func TestThrottleHTTP(t *testing.T) {
+	limiter, _ := ratelimiter.NewLimiter(time.Second, &mockCache{})
+	keyFunc := func(r *http.Request) string {
+		return "key"
+	}
+	tests := []struct {
+		name               string
+		expectedProceed    bool
+		expectedStatus     int
+		expectedRetryAfter string
+	}{
+		{"first call", true, http.StatusOK, ""},
+		{"throttled", false, http.StatusTooManyRequests, "60"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			proceed := ThrottleHTTP(limiter, time.Minute, w, httptest.NewRequest(http.MethodGet, "/", nil), keyFunc)
+			if proceed != test.expectedProceed {
+				t.Errorf("Expected %v, got %v", test.expectedProceed, proceed)
+			}
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+			if h := w.Header().Get("Retry-After"); h != test.expectedRetryAfter {
+				t.Errorf("Expected Retry-After of %q, got %q", test.expectedRetryAfter, h)
+			}
+		})
+	}
+}
+
+func TestHandler_Blocked(t *testing.T) {
+	limiter, _ := ratelimiter.NewLimiter(time.Second, &mockCache{})
+	limiter.Block("key", time.Now().Add(time.Minute), "")
+	handler := Handler(limiter, time.Second, func(r *http.Request) string {
+		return "key"
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if h := w.Header().Get("Retry-After"); h != "60" {
+		t.Errorf("Expected Retry-After of %q, got %q", "60", h)
+	}
+}
+
+func TestHandler_RateLimitHeaders(t *testing.T) {
+	bucket, _ := ratelimiter.NewTokenBucket(3, time.Second, &mockCache{})
+	handler := Handler(bucket, time.Minute, func(r *http.Request) string {
+		return "key"
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if h := w.Header().Get("RateLimit-Limit"); h != "3" {
+		t.Errorf("Expected RateLimit-Limit of %q, got %q", "3", h)
+	}
+	if h := w.Header().Get("RateLimit-Policy"); h != "3;w=180" {
+		t.Errorf("Expected RateLimit-Policy of %q, got %q", "3;w=180", h)
+	}
+	if h := w.Header().Get("RateLimit-Remaining"); h != "2" {
+		t.Errorf("Expected RateLimit-Remaining of %q, got %q", "2", h)
+	}
+	if h := w.Header().Get("RateLimit-Reset"); h != "60" {
+		t.Errorf("Expected RateLimit-Reset of %q, got %q", "60", h)
+	}
+
+	noop := Handler(ratelimiter.NewNoopRateLimiter(), time.Minute, func(r *http.Request) string {
+		return "key"
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w = httptest.NewRecorder()
+	noop.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if h := w.Header().Get("RateLimit-Limit"); h != "" {
+		t.Errorf("Unexpected RateLimit-Limit of %q", h)
+	}
+	if h := w.Header().Get("RateLimit-Policy"); h != "" {
+		t.Errorf("Unexpected RateLimit-Policy of %q", h)
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected int
+	}{
+		{ratelimiter.ErrWouldExceedDeadline, http.StatusTooManyRequests},
+		{&ratelimiter.DeadlineExceededError{}, http.StatusTooManyRequests},
+		{ratelimiter.ErrBlockTooLong, http.StatusTooManyRequests},
+		{ratelimiter.ErrOpen, http.StatusTooManyRequests},
+		{ratelimiter.ErrBucketFull, http.StatusTooManyRequests},
+		{ratelimiter.ErrTooManyInflight, http.StatusTooManyRequests},
+		{ratelimiter.ErrTooManyConcurrent, http.StatusTooManyRequests},
+		{ratelimiter.ErrBlocked, http.StatusForbidden},
+		{ratelimiter.ErrClosed, http.StatusServiceUnavailable},
+		{context.Canceled, statusClientClosedRequest},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{ratelimiter.ErrInvalidCache, http.StatusInternalServerError},
+		{ratelimiter.ErrInvalidCost, http.StatusInternalServerError},
+		{ratelimiter.ErrInvalidThreshold, http.StatusInternalServerError},
+		{ratelimiter.ErrMalformedKey, http.StatusInternalServerError},
+		{ratelimiter.ErrPlaintextKeys, http.StatusInternalServerError},
+		{fmt.Errorf("wrapped: %w", ratelimiter.ErrBlocked), http.StatusForbidden},
+		{errors.New("did not work"), http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		if status := HTTPStatus(test.err); status != test.expected {
+			t.Errorf("Expected %d for %v, got %d", test.expected, test.err, status)
+		}
+	}
+}
+
+func TestCanRetry(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{ratelimiter.ErrWouldExceedDeadline, true},
+		{ratelimiter.ErrClosed, true},
+		{&ratelimiter.BlockedError{Until: time.Now().Add(time.Minute)}, true},
+		{ratelimiter.ErrBlocked, false},
+		{&ratelimiter.BlockedError{}, false},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, false},
+		{ratelimiter.ErrInvalidCache, false},
+	}
+	for _, test := range tests {
+		if result := canRetry(HTTPStatus(test.err), test.err); result != test.expected {
+			t.Errorf("Expected %v for %v, got %v", test.expected, test.err, result)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		delay    time.Duration
+		expected string
+	}{
+		{0, "1"},
+		{time.Millisecond, "1"},
+		{time.Second, "1"},
+		{time.Second + time.Millisecond, "2"},
+	}
+	for _, test := range tests {
+		if result := retryAfter(test.delay); result != test.expected {
+			t.Errorf("Expected %s for %v, got %s", test.expected, test.delay, result)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Mux is a Throttler that routes each call to one of several throttlers
+// depending on the class of its identifier, e.g. for applying different
+// policies to different groups of routes.
+type Mux struct {
+	classify func(identifier string) string
+	classes  map[string]Throttler
+	fallback Throttler
+}
+
+// NewMux creates a new Mux that uses classify for deriving the class of
+// each identifier and throttles calls using the throttler registered for
+// that class in classes. Calls using identifiers of an unknown class are
+// throttled using fallback. classify, fallback and each registered
+// throttler are required.
+func NewMux(classify func(identifier string) string, classes map[string]Throttler, fallback Throttler) (*Mux, error) {
+	if classify == nil {
+		return nil, errors.New("ratelimiter: a mux requires a classify func")
+	}
+	if fallback == nil {
+		return nil, errors.New("ratelimiter: a mux requires a fallback throttler")
+	}
+	m := &Mux{
+		classify: classify,
+		classes:  map[string]Throttler{},
+		fallback: fallback,
+	}
+	for class, t := range classes {
+		if t == nil {
+			return nil, fmt.Errorf("ratelimiter: no throttler given for class %q", class)
+		}
+		m.classes[class] = t
+	}
+	return m, nil
+}
+
+func (m *Mux) route(identifier string) Throttler {
+	if t, ok := m.classes[m.classify(identifier)]; ok {
+		return t
+	}
+	return m.fallback
+}
+
+// LinearThrottle linearly throttles using the throttler for the class of
+// the given identifier.
+func (m *Mux) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return m.route(identifier).LinearThrottle(threshold, identifier)
+}
+
+// ExponentialThrottle exponentially throttles using the throttler for the
+// class of the given identifier.
+func (m *Mux) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return m.route(identifier).ExponentialThrottle(threshold, identifier)
+}
+
+// LinearThrottleCtx works like LinearThrottle, but stops waiting as soon as
+// the given context is cancelled.
+func (m *Mux) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return LinearThrottleCtx(ctx, m.route(identifier), threshold, identifier)
+}
+
+// ExponentialThrottleCtx works like ExponentialThrottle, but stops waiting
+// as soon as the given context is cancelled.
+func (m *Mux) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return ExponentialThrottleCtx(ctx, m.route(identifier), threshold, identifier)
+}
+
+// Close closes all routed throttlers implementing Closer, returning the
+// first error encountered.
+func (m *Mux) Close(ctx context.Context) error {
+	throttlers := chain{m.fallback}
+	for _, t := range m.classes {
+		throttlers = append(throttlers, t)
+	}
+	return throttlers.Close(ctx)
+}
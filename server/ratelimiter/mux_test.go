@@ -0,0 +1,54 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMux(t *testing.T) {
+	strict, _ := NewLimiter(time.Millisecond, &mockGetSetter{})
+	loose, _ := NewSlidingWindow(10, time.Millisecond, &mockGetSetter{})
+	mux, _ := NewMux(classifyPrefix, map[string]Throttler{"auth": strict}, loose)
+
+	tests := []struct {
+		identifier    string
+		expectedError error
+	}{
+		{"auth:a", nil},
+		{"auth:a", ErrWouldExceedDeadline},
+		{"read:a", nil},
+		{"read:a", nil},
+		{"unknown", nil},
+	}
+	for _, test := range tests {
+		result := <-mux.LinearThrottle(time.Minute, test.identifier)
+		if !errors.Is(result.Error, test.expectedError) {
+			t.Errorf("%s: expected %v, got %v", test.identifier, test.expectedError, result.Error)
+		}
+	}
+}
+
+func TestNewMux(t *testing.T) {
+	limiter, _ := NewLimiter(time.Millisecond, &mockGetSetter{})
+	if _, err := NewMux(nil, nil, limiter); err == nil {
+		t.Error("Expected error when passing no classify func")
+	}
+	if _, err := NewMux(classifyPrefix, nil, nil); err == nil {
+		t.Error("Expected error when passing no fallback")
+	}
+	if _, err := NewMux(classifyPrefix, map[string]Throttler{"auth": nil}, limiter); err == nil {
+		t.Error("Expected error when passing class without throttler")
+	}
+	if _, err := NewMux(classifyPrefix, map[string]Throttler{"auth": limiter}, limiter); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func classifyPrefix(identifier string) string {
+	return strings.SplitN(identifier, ":", 2)[0]
+}
@@ -0,0 +1,39 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"time"
+)
+
+// Observer can be used to get notified about every decision a throttler
+// makes, e.g. for collecting metrics. Keys passed are the hashed
+// identifiers used for storing limits in the cache.
+type Observer interface {
+	OnAllowed(key string)
+	OnThrottled(key string, delay time.Duration)
+	OnError(key string, err error)
+}
+
+// WithObserver makes the throttler notify the given Observer about
+// each decision that is made.
+func WithObserver(observer Observer) Option {
+	return func(o *options) {
+		o.observer = observer
+	}
+}
+
+func (o *options) observe(key string, delay time.Duration, err error) {
+	if o.observer == nil {
+		return
+	}
+	switch {
+	case err != nil:
+		o.observer.OnError(key, err)
+	case delay > 0:
+		o.observer.OnThrottled(key, delay)
+	default:
+		o.observer.OnAllowed(key)
+	}
+}
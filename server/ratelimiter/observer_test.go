@@ -0,0 +1,56 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockObserver struct {
+	lock      sync.Mutex
+	allowed   int
+	throttled int
+	errors    int
+}
+
+func (m *mockObserver) OnAllowed(key string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.allowed++
+}
+
+func (m *mockObserver) OnThrottled(key string, delay time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.throttled++
+}
+
+func (m *mockObserver) OnError(key string, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.errors++
+}
+
+func TestWithObserver(t *testing.T) {
+	observer := &mockObserver{}
+	limiter, _ := NewLimiter(time.Millisecond*15, &mockGetSetter{}, WithObserver(observer))
+
+	<-limiter.LinearThrottle(time.Millisecond*10, "observer")
+	a := limiter.LinearThrottle(time.Millisecond*10, "observer")
+	b := limiter.LinearThrottle(time.Millisecond*10, "observer")
+	<-a
+	<-b
+
+	if observer.allowed != 1 {
+		t.Errorf("Expected 1 allowed call, got %d", observer.allowed)
+	}
+	if observer.throttled != 1 {
+		t.Errorf("Expected 1 throttled call, got %d", observer.throttled)
+	}
+	if observer.errors != 1 {
+		t.Errorf("Expected 1 error, got %d", observer.errors)
+	}
+}
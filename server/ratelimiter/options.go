@@ -0,0 +1,617 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Option is used to configure a throttler on creation
+type Option func(*options)
+
+type options struct {
+	clock              Clock
+	timeout            time.Duration
+	salt               []byte
+	hasher             func([]byte) string
+	keyNormalizer      func(string) string
+	plaintextKeys      bool
+	namespace          string
+	keyIndex           *sync.Map
+	timePrecision      time.Duration
+	breakerFailures    int
+	breakerCooldown    time.Duration
+	observer           Observer
+	jitter             float64
+	maxInflight        int
+	inflight           chan struct{}
+	maxSleep           time.Duration
+	minSleep           time.Duration
+	failurePolicy      FailurePolicy
+	corruptCachePolicy CorruptCachePolicy
+	saltLength         int
+	dryRun             bool
+	drain              *drain
+	idempotencyTTL     time.Duration
+	initialSpread      time.Duration
+	burstSize          int
+	metrics            *metrics
+	rand               io.Reader
+	softLimit          float64
+	historySize        int
+	nonBlocking        bool
+	history            *history
+}
+
+func newOptions(opts ...Option) (options, error) {
+	o := options{
+		clock:      realClock{},
+		hasher:     sha256Hex,
+		drain:      &drain{},
+		metrics:    &metrics{},
+		rand:       rand.Reader,
+		saltLength: 16,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.timeout < 0 {
+		return o, errors.New("ratelimiter: timeout must not be negative")
+	}
+	if o.maxInflight < 0 {
+		return o, errors.New("ratelimiter: maximum number of inflight calls must be positive")
+	}
+	if o.maxInflight > 0 {
+		o.inflight = make(chan struct{}, o.maxInflight)
+	}
+	if o.maxSleep < 0 {
+		return o, errors.New("ratelimiter: maximum sleep must not be negative")
+	}
+	if o.minSleep < 0 {
+		return o, errors.New("ratelimiter: minimum sleep must not be negative")
+	}
+	if o.timePrecision < 0 {
+		return o, errors.New("ratelimiter: time precision must not be negative")
+	}
+	if o.breakerFailures < 0 || o.breakerCooldown < 0 {
+		return o, errors.New("ratelimiter: circuit breaker settings must not be negative")
+	}
+	if o.burstSize < 0 {
+		return o, errors.New("ratelimiter: burst must not be negative")
+	}
+	if o.initialSpread < 0 {
+		return o, errors.New("ratelimiter: initial spread must not be negative")
+	}
+	if o.historySize < 0 {
+		return o, errors.New("ratelimiter: history size must not be negative")
+	}
+	if o.historySize > 0 {
+		o.history = newHistory(o.historySize)
+	}
+	if o.softLimit < 0 || o.softLimit > 1 {
+		return o, errors.New("ratelimiter: soft limit must be a fraction between 0 and 1")
+	}
+	if o.jitter < 0 {
+		return o, errors.New("ratelimiter: jitter must not be negative")
+	}
+	if o.saltLength < minSaltLength {
+		return o, fmt.Errorf("ratelimiter: salt length must be at least %d bytes", minSaltLength)
+	}
+	if o.rand == nil {
+		return o, errors.New("ratelimiter: random source must not be nil")
+	}
+	if o.plaintextKeys && o.observer != nil {
+		o.observer.OnError("", ErrPlaintextKeys)
+	}
+	if o.salt == nil {
+		salt, err := randomBytes(o.rand, o.saltLength)
+		if err != nil {
+			return o, fmt.Errorf("ratelimiter: error creating salt: %w", err)
+		}
+		o.salt = salt
+	}
+	return o, nil
+}
+
+func (o *options) hash(s string) string {
+	return o.hashWithSalt(s, o.salt)
+}
+
+// saltedPool holds buffers for joining identifiers and salts, so hashing
+// does not allocate on each call.
+var saltedPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 64)
+		return &b
+	},
+}
+
+func (o *options) hashWithSalt(s string, salt []byte) string {
+	if o.keyNormalizer != nil {
+		s = o.keyNormalizer(s)
+	}
+	if o.plaintextKeys {
+		return o.namespaced(s)
+	}
+	buf := saltedPool.Get().(*[]byte)
+	joined := append(append((*buf)[:0], s...), salt...)
+	key := o.namespaced(o.hasher(joined))
+	*buf = joined
+	saltedPool.Put(buf)
+	o.index(key, s)
+	return key
+}
+
+// WithNamespace makes the throttler prefix all cache keys with the given
+// namespace, so multiple throttlers can share a cache without their limits
+// colliding, even when using the same salt set using WithSalt. The
+// namespace is prefixed with its length, so no two namespaces can produce
+// the same key.
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+func (o *options) namespaced(key string) string {
+	if o.namespace == "" {
+		return key
+	}
+	return ThrottleKey(o.namespace) + key
+}
+
+// owns strips the namespace from the given key, returning false in case
+// the key does not use the throttler's namespace.
+func (o *options) owns(key string) (string, bool) {
+	if o.namespace == "" {
+		return key, true
+	}
+	prefix := ThrottleKey(o.namespace)
+	if !strings.HasPrefix(key, prefix) {
+		return "", false
+	}
+	return key[len(prefix):], true
+}
+
+// run applies the given decision and sends the result on the returned
+// channel once the returned delay has passed. Calls that do not need to
+// wait are handled synchronously, so only calls that are actually delayed
+// occupy a goroutine.
+func (o *options) run(ctx context.Context, key string, decide func() (time.Duration, error)) <-chan Result {
+	return o.runWith(ctx, key, nil, decide)
+}
+
+// decision carries details about a decision that are set by decide when
+// calling runWith.
+type decision struct {
+	// used is the fraction of the budget used up by the call, see
+	// WithSoftLimit.
+	used float64
+	// source names the limit responsible for the result.
+	source string
+}
+
+// runWith works like run, applying the details stored in d by decide to
+// the result.
+func (o *options) runWith(ctx context.Context, key string, d *decision, decide func() (time.Duration, error)) <-chan Result {
+	if err := o.admit(key); err != nil {
+		return o.wait(context.Background(), Result{Error: err}, func() {})
+	}
+	delay, err := decide()
+	result := o.result(key, delay, err)
+	if d != nil {
+		result.Warning = result.Error == nil && o.warn(d.used)
+		if d.source != "" {
+			result.Source = d.source
+		}
+	}
+	return o.wait(ctx, result, o.release)
+}
+
+// wait sends the given result on the returned channel once its delay has
+// passed, calling release afterwards.
+func (o *options) wait(ctx context.Context, result Result, release func()) <-chan Result {
+	out := make(chan Result, 1)
+	if o.nonBlocking && result.Error == nil && result.Delay > 0 {
+		result.Deferred = true
+	}
+	if result.Error != nil || result.Delay <= 0 || result.Deferred {
+		out <- result
+		close(out)
+		release()
+		return out
+	}
+	go func() {
+		defer release()
+		defer close(out)
+		start := o.clock.Now()
+		if err := sleep(ctx, o.clock, result.Delay); err != nil {
+			out <- Result{Error: err}
+			return
+		}
+		result.Observed = o.clock.Now().Sub(start)
+		out <- result
+	}()
+	return out
+}
+
+// admit acquires the resources held by a call, which need to be freed
+// using release unless an error is returned.
+func (o *options) admit(key string) error {
+	if !o.drain.acquire() {
+		return ErrClosed
+	}
+	if o.inflight != nil {
+		select {
+		case o.inflight <- struct{}{}:
+		default:
+			o.drain.release()
+			o.observe(key, 0, ErrTooManyInflight)
+			o.record(key, 0, ErrTooManyInflight)
+			return ErrTooManyInflight
+		}
+	}
+	return nil
+}
+
+// check works like run for callers that never wait themselves, returning
+// the delay and error as decided instead of a Result.
+func (o *options) check(key string, decide func() (time.Duration, error)) (time.Duration, error) {
+	if err := o.admit(key); err != nil {
+		return 0, err
+	}
+	defer o.release()
+	delay, err := decide()
+	o.observe(key, delay, err)
+	o.record(key, delay, err)
+	if o.dryRunIgnores(err) {
+		return 0, nil
+	}
+	return delay, err
+}
+
+// dryRunIgnores reports whether a call with the given outcome is passed
+// when running using WithDryRun.
+func (o *options) dryRunIgnores(err error) bool {
+	return o.dryRun && (err == nil || errors.Is(err, ErrWouldExceedDeadline) || errors.Is(err, ErrOpen))
+}
+
+// result computes the result for the given decision before waiting.
+func (o *options) result(key string, delay time.Duration, err error) Result {
+	if err == nil && delay > 0 {
+		delay = o.applyJitter(delay)
+	}
+	o.observe(key, delay, err)
+	o.record(key, delay, err)
+	if o.dryRunIgnores(err) {
+		return Result{}
+	}
+	return o.shape(delay, err)
+}
+
+// shape applies the options limiting the time to sleep to the given
+// decision, without observing or recording it.
+func (o *options) shape(delay time.Duration, err error) Result {
+	var retryAt time.Time
+	if delay > 0 {
+		retryAt = o.clock.Now().Add(delay)
+	}
+	if err != nil {
+		return Result{Error: err, Delay: delay, RetryAt: retryAt, Source: o.namespace}
+	}
+	if delay > 0 && delay < o.minSleep {
+		delay, retryAt = 0, time.Time{}
+	}
+	var partial bool
+	if o.maxSleep > 0 && delay > o.maxSleep {
+		delay, partial = o.maxSleep, true
+	}
+	return Result{Delay: delay, Partial: partial, RetryAt: retryAt, Source: o.namespace}
+}
+
+// release frees the resources held by a call.
+func (o *options) release() {
+	if o.inflight != nil {
+		<-o.inflight
+	}
+	o.drain.release()
+}
+
+// sleep blocks for the given duration or until the context is done,
+// whichever happens first. The timer is stopped when returning early, so it
+// does not hold on to resources until the full duration has passed.
+func sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	c, stop := clock.NewTimer(d)
+	defer stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c:
+		return nil
+	}
+}
+
+func (o *options) getClock() Clock {
+	return o.clock
+}
+
+// WithClock makes the throttler use the given clock instead of the system's.
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithTimeout sets the maximum delay a caller will be asked to wait for.
+// Calls that would need to wait longer return an error instead. The timeout
+// should be at least as long as the thresholds used, as otherwise calls
+// exceeding the limit are always rejected instead of being delayed. Negative
+// timeouts are rejected when creating the throttler.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithSalt makes the throttler use the given salt when hashing identifiers
+// instead of generating a random one. This allows multiple instances sharing
+// a distributed cache to derive the same keys for the same identifiers.
+// Reusing a salt across instances and restarts weakens the protection
+// against enumerating identifiers from the cache, so it should only be
+// used when limits need to be coordinated across instances.
+func WithSalt(salt []byte) Option {
+	return func(o *options) {
+		o.salt = append([]byte{}, salt...)
+	}
+}
+
+// minSaltLength is the minimum length of randomly generated salts.
+const minSaltLength = 8
+
+// WithSaltLength sets the length in bytes of the salt that is randomly
+// generated in case no salt is set using WithSalt. Lengths below 8 bytes
+// are rejected. The default length is 16 bytes.
+func WithSaltLength(n int) Option {
+	return func(o *options) {
+		o.saltLength = n
+	}
+}
+
+// WithRandReader makes the throttler read randomness for generating salts
+// and applying jitter from r instead of crypto/rand.Reader, e.g. for using
+// an approved source in restricted environments or for getting
+// deterministic results in tests. Sampled reads from the reader of the
+// throttler it wraps.
+func WithRandReader(r io.Reader) Option {
+	return func(o *options) {
+		o.rand = r
+	}
+}
+
+func (o *options) getRand() io.Reader {
+	return o.rand
+}
+
+// randOf returns the source of randomness used by the given Throttler,
+// falling back to crypto/rand.Reader for throttlers that do not use one.
+func randOf(t Throttler) io.Reader {
+	if r, ok := t.(interface{ getRand() io.Reader }); ok {
+		return r.getRand()
+	}
+	return rand.Reader
+}
+
+// WithHasher makes the throttler use the given function for deriving cache
+// keys instead of SHA-256. The function receives the already salted
+// identifier and returns the key to use. The given slice is reused after
+// the function returns, so it must not be retained.
+func WithHasher(hasher func([]byte) string) Option {
+	return func(o *options) {
+		o.hasher = hasher
+	}
+}
+
+// ErrPlaintextKeys is passed to the Observer when creating a throttler
+// using WithPlaintextKeys.
+var ErrPlaintextKeys = errors.New("ratelimiter: identifiers are stored in plaintext, which is insecure")
+
+// WithPlaintextKeys makes the throttler store limits using the identifiers
+// as keys, without salting or hashing them, so keys can be constructed and
+// inspected by hand while debugging. This is insecure as anyone with access
+// to the cache can read all identifiers, and must only be used during
+// development. A configured Observer is notified by passing
+// ErrPlaintextKeys to OnError using an empty key when creating the
+// throttler.
+func WithPlaintextKeys() Option {
+	return func(o *options) {
+		o.plaintextKeys = true
+	}
+}
+
+// WithKeyNormalizer makes the throttler pass each identifier through the
+// given function before the salt is appended and the result is hashed, e.g.
+// for lowercasing or trimming identifiers taken from user input so that
+// variations of the same identifier share a single limit. By default,
+// identifiers are used as given.
+func WithKeyNormalizer(normalize func(string) string) Option {
+	return func(o *options) {
+		o.keyNormalizer = normalize
+	}
+}
+
+// WithTimePrecision makes window based throttlers round the timestamps
+// they store up to the given granularity, which makes stored values
+// smaller. As timestamps are rounded up, limits are never loosened, but
+// calls may be delayed for up to one unit of precision more than needed.
+// Window boundaries are not affected. By default, timestamps are stored as
+// is.
+func WithTimePrecision(d time.Duration) Option {
+	return func(o *options) {
+		o.timePrecision = d
+	}
+}
+
+// roundUp rounds the given time up to the configured time precision.
+func (o *options) roundUp(t time.Time) time.Time {
+	if o.timePrecision == 0 {
+		return t
+	}
+	rounded := t.Truncate(o.timePrecision)
+	if rounded.Before(t) {
+		rounded = rounded.Add(o.timePrecision)
+	}
+	return rounded
+}
+
+// WithJitter makes the throttler randomly extend each delay by up to the
+// given fraction of the delay, so that callers that are being throttled
+// at the same time do not all continue at the same time. Delays are never
+// shortened as this would violate the limit.
+func WithJitter(fraction float64) Option {
+	return func(o *options) {
+		o.jitter = fraction
+	}
+}
+
+func (o *options) applyJitter(delay time.Duration) time.Duration {
+	if o.jitter == 0 {
+		return delay
+	}
+	f, err := randomFloat(o.rand)
+	if err != nil {
+		return delay
+	}
+	return delay + time.Duration(f*o.jitter*float64(delay))
+}
+
+// WithInitialSpread makes a Limiter add a random offset of up to d to the
+// limit stored for identifiers that are seen for the first time, so the
+// limits of many identifiers appearing at the same time do not pass at the
+// same time either. This only affects the first call, calls made while a
+// limit is stored keep their distance as usual.
+func WithInitialSpread(d time.Duration) Option {
+	return func(o *options) {
+		o.initialSpread = d
+	}
+}
+
+func (o *options) spread() time.Duration {
+	if o.initialSpread == 0 {
+		return 0
+	}
+	f, err := randomFloat(o.rand)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(f * float64(o.initialSpread))
+}
+
+// WithSoftLimit makes throttlers that allow multiple calls per threshold
+// set Warning on results once the given fraction of an identifier's budget
+// has been used up, e.g. 0.8 for warning callers after 80% of the calls
+// allowed, so they can back off before actually being delayed. Calls are
+// still only delayed once the full budget has been used up. A Limiter
+// allows a single call per threshold, so it never warns.
+func WithSoftLimit(fraction float64) Option {
+	return func(o *options) {
+		o.softLimit = fraction
+	}
+}
+
+func (o *options) warn(used float64) bool {
+	return o.softLimit > 0 && used >= o.softLimit
+}
+
+// reportUsage stores the fraction of the budget used in case the caller
+// asked for it.
+func reportUsage(used *float64, fraction float64) {
+	if used != nil {
+		*used = fraction
+	}
+}
+
+// WithNonBlocking makes the throttler never wait for delays itself, e.g.
+// when being used in an event loop where sleeping is not allowed. Calls
+// that need to be delayed return right away, setting Deferred on the
+// result. The limit is updated as usual, so callers are expected to wait
+// for Delay themselves before proceeding.
+func WithNonBlocking() Option {
+	return func(o *options) {
+		o.nonBlocking = true
+	}
+}
+
+// WithBurst makes a Limiter allow the first n calls for identifiers that
+// are seen for the first time without any delay, e.g. for not throttling
+// the calls a new client makes when setting up. After the burst, calls
+// keep their distance as usual, starting from the last call of the burst.
+// Identifiers are considered new once their limit has expired.
+func WithBurst(n int) Option {
+	return func(o *options) {
+		o.burstSize = n
+	}
+}
+
+// burst returns the number of calls that can be made without delay after
+// the first call for an identifier.
+func (o *options) burst() int64 {
+	if o.burstSize < 2 {
+		return 0
+	}
+	return int64(o.burstSize - 1)
+}
+
+// ErrTooManyInflight is returned when the maximum number of concurrent
+// calls set using WithMaxInflight has been reached.
+var ErrTooManyInflight = errors.New("ratelimiter: too many inflight calls")
+
+// WithDryRun makes the throttler store limits and compute delays as usual
+// but never delay or reject calls because of them. Calls that would have
+// been rejected for exceeding the timeout are only reported to the
+// Observer, which allows sizing thresholds against real traffic before
+// enforcing them. Other errors are still returned.
+func WithDryRun(dryRun bool) Option {
+	return func(o *options) {
+		o.dryRun = dryRun
+	}
+}
+
+// WithMaxInflight limits the number of calls that are being processed
+// concurrently to n. As each call that is waiting for its delay occupies
+// a goroutine, this bounds the resources used under high load at the cost
+// of rejecting calls using ErrTooManyInflight once the limit is reached.
+// Passing zero disables the limit, which is the default.
+func WithMaxInflight(n int) Option {
+	return func(o *options) {
+		o.maxInflight = n
+	}
+}
+
+// WithMinSleep makes the throttler skip waiting for delays shorter than the
+// given duration, as sleeping for very short durations costs more than the
+// delay itself. Such calls are allowed right away and report a Delay of
+// zero, while the stored limit is advanced as usual. Passing zero makes the
+// throttler always wait for the computed delay, which is the default.
+func WithMinSleep(d time.Duration) Option {
+	return func(o *options) {
+		o.minSleep = d
+	}
+}
+
+// WithMaxSleep caps the time a single call will wait. Calls that would need
+// to wait longer wait for the given duration only and return a Result with
+// Partial set, leaving it to the caller to decide how to proceed. Calls
+// exceeding the timeout still return an error.
+func WithMaxSleep(d time.Duration) Option {
+	return func(o *options) {
+		o.maxSleep = d
+	}
+}
@@ -0,0 +1,495 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []Option
+		expectError bool
+	}{
+		{
+			"no options",
+			nil,
+			true,
+		},
+		{
+			"negative timeout",
+			[]Option{WithTimeout(-time.Second)},
+			true,
+		},
+		{
+			"negative jitter",
+			[]Option{WithTimeout(time.Second), WithJitter(-0.5)},
+			true,
+		},
+		{
+			"negative inflight",
+			[]Option{WithTimeout(time.Second), WithMaxInflight(-1)},
+			true,
+		},
+		{
+			"short salt length",
+			[]Option{WithTimeout(time.Second), WithSaltLength(4)},
+			true,
+		},
+		{
+			"ok",
+			[]Option{WithTimeout(time.Second)},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter, err := NewWithOptions(&mockGetSetter{}, test.opts...)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if (limiter == nil) != test.expectError {
+				t.Errorf("Unexpected limiter %v", limiter)
+			}
+		})
+	}
+}
+
+func TestWithSalt(t *testing.T) {
+	salt := []byte("shared-salt")
+	a, _ := NewWithOptions(&mockGetSetter{}, WithTimeout(time.Second), WithSalt(salt))
+	b, _ := NewWithOptions(&mockGetSetter{}, WithTimeout(time.Second), WithSalt(salt))
+	c, _ := NewWithOptions(&mockGetSetter{}, WithTimeout(time.Second))
+
+	if a.hash("identifier") != b.hash("identifier") {
+		t.Error("Expected limiters using the same salt to derive the same key")
+	}
+	if a.hash("identifier") == c.hash("identifier") {
+		t.Error("Expected limiters using different salts to derive different keys")
+	}
+}
+
+func TestWithSaltLength(t *testing.T) {
+	for _, length := range []int{8, 32} {
+		limiter, err := NewWithOptions(&mockGetSetter{}, WithTimeout(time.Second), WithSaltLength(length))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(limiter.salt) != length {
+			t.Errorf("Expected salt of %d bytes, got %d", length, len(limiter.salt))
+		}
+	}
+}
+
+func TestWithRandReader(t *testing.T) {
+	limiter, err := NewWithOptions(
+		&mockGetSetter{},
+		WithTimeout(time.Second),
+		WithSaltLength(8),
+		WithRandReader(bytes.NewReader([]byte("12345678"))),
+		WithHasher(func(b []byte) string {
+			return string(b)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if key := limiter.hash("identifier"); key != "identifier12345678" {
+		t.Errorf("Expected %v, got %v", "identifier12345678", key)
+	}
+
+	if _, err := NewWithOptions(&mockGetSetter{}, WithTimeout(time.Second), WithRandReader(bytes.NewReader(nil))); err == nil {
+		t.Error("Expected error when random source is exhausted")
+	}
+	if _, err := NewWithOptions(&mockGetSetter{}, WithTimeout(time.Second), WithRandReader(nil)); err == nil {
+		t.Error("Expected error when passing nil random source")
+	}
+}
+
+func TestWithNamespace(t *testing.T) {
+	cache := &mockGetSetter{}
+	salt := []byte("shared-salt")
+	orders, _ := NewLimiter(time.Hour, cache, WithSalt(salt), WithNamespace("orders"))
+	logins, _ := NewLimiter(time.Hour, cache, WithSalt(salt), WithNamespace("logins"))
+	shared, _ := NewLimiter(time.Hour, cache, WithSalt(salt), WithNamespace("orders"))
+
+	if orders.Key("user") == logins.Key("user") {
+		t.Error("Expected namespaces to derive different keys")
+	}
+	if ok, _, _ := orders.LinearAllow(time.Minute, "user"); !ok {
+		t.Error("Expected first call to be allowed")
+	}
+	if ok, _, _ := logins.LinearAllow(time.Minute, "user"); !ok {
+		t.Error("Expected limit not to be shared across namespaces")
+	}
+	if ok, _, _ := shared.LinearAllow(time.Minute, "user"); ok {
+		t.Error("Expected limit to be shared within a namespace")
+	}
+
+	a, _ := NewLimiter(time.Hour, cache, WithPlaintextKeys(), WithNamespace("a"))
+	b, _ := NewLimiter(time.Hour, cache, WithPlaintextKeys(), WithNamespace("a:b"))
+	if a.Key("b:c") == b.Key("c") {
+		t.Errorf("Expected namespaces not to collide, got %v", a.Key("b:c"))
+	}
+}
+
+func TestWithHasher(t *testing.T) {
+	limiter, _ := NewWithOptions(
+		&mockGetSetter{},
+		WithTimeout(time.Second),
+		WithSalt([]byte("-salt")),
+		WithHasher(func(b []byte) string {
+			return string(b)
+		}),
+	)
+	if key := limiter.hash("identifier"); key != "identifier-salt" {
+		t.Errorf("Unexpected key %v", key)
+	}
+}
+
+func TestWithKeyNormalizer(t *testing.T) {
+	limiter, _ := NewWithOptions(
+		&mockGetSetter{},
+		WithTimeout(time.Minute),
+		WithKeyNormalizer(func(s string) string {
+			return strings.ToLower(strings.TrimSpace(s))
+		}),
+	)
+	if ok, _, err := limiter.LinearAllow(time.Second, "User@X.com"); !ok || err != nil {
+		t.Errorf("Expected first call to be allowed, got %v", err)
+	}
+	if ok, _, _ := limiter.LinearAllow(time.Second, " user@x.com"); ok {
+		t.Error("Expected identifiers to share a limit")
+	}
+	if limiter.Key("User@X.com") != limiter.Key("user@x.com") {
+		t.Error("Expected normalized identifiers to derive the same key")
+	}
+}
+
+func TestWithPlaintextKeys(t *testing.T) {
+	observer := &mockObserver{}
+	cache := &mockGetSetter{}
+	limiter, _ := NewLimiter(
+		time.Second,
+		cache,
+		WithPlaintextKeys(),
+		WithObserver(observer),
+		WithKeyNormalizer(strings.ToLower),
+	)
+	if key := limiter.Key("User"); key != "user" {
+		t.Errorf("Expected plaintext key, got %v", key)
+	}
+	limiter.LinearAllow(time.Second, "User")
+	if _, found := cache.Get("user"); !found {
+		t.Error("Expected limit to be stored using the plaintext key")
+	}
+	if observer.errors != 1 {
+		t.Errorf("Expected warning to be passed to observer once, got %v", observer.errors)
+	}
+}
+
+func TestWithTimePrecision(t *testing.T) {
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		precision time.Duration
+		value     time.Time
+		expected  time.Time
+	}{
+		{0, base.Add(time.Microsecond), base.Add(time.Microsecond)},
+		{time.Second, base, base},
+		{time.Second, base.Add(time.Microsecond), base.Add(time.Second)},
+		{time.Second, base.Add(time.Millisecond * 999), base.Add(time.Second)},
+	}
+	for _, test := range tests {
+		o, _ := newOptions(WithTimePrecision(test.precision))
+		if result := o.roundUp(test.value); !result.Equal(test.expected) {
+			t.Errorf("Expected %v, got %v", test.expected, result)
+		}
+	}
+	if _, err := newOptions(WithTimePrecision(-time.Second)); err == nil {
+		t.Error("Expected error for negative precision")
+	}
+}
+
+func TestWithJitter(t *testing.T) {
+	o, _ := newOptions(WithJitter(0.5))
+	for i := 0; i < 100; i++ {
+		delay := o.applyJitter(time.Second)
+		if delay < time.Second || delay > time.Second*3/2 {
+			t.Errorf("Unexpected delay %v", delay)
+		}
+	}
+
+	o, _ = newOptions()
+	if delay := o.applyJitter(time.Second); delay != time.Second {
+		t.Errorf("Expected delay to be unchanged, got %v", delay)
+	}
+}
+
+func TestWithInitialSpread(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := ratelimitertest.NewFakeClock(now)
+	limiter, _ := NewLimiter(time.Hour, ratelimitertest.NewRecordingCache(clock), WithClock(clock), WithInitialSpread(time.Minute))
+
+	distinct := map[time.Duration]bool{}
+	for i := 0; i < 20; i++ {
+		identifier := fmt.Sprintf("id-%d", i)
+		limiter.LinearAllow(time.Minute, identifier)
+		remaining, _ := limiter.Peek(identifier)
+		if remaining < time.Minute || remaining >= 2*time.Minute {
+			t.Errorf("Unexpected initial limit %v", remaining)
+		}
+		distinct[remaining] = true
+
+		// subsequent calls are spaced by the threshold only
+		_, delay, _ := limiter.LinearAllow(time.Minute, identifier)
+		if next, _ := limiter.Peek(identifier); delay != remaining || next != remaining+time.Minute {
+			t.Errorf("Expected spacing of %v, got %v after %v", time.Minute, next, delay)
+		}
+	}
+	if len(distinct) < 2 {
+		t.Errorf("Expected initial limits to be spread, got %v", distinct)
+	}
+
+	if _, err := NewLimiter(time.Hour, &mockGetSetter{}, WithInitialSpread(-time.Second)); err == nil {
+		t.Error("Expected error when passing negative spread")
+	}
+}
+
+func TestWithSoftLimit(t *testing.T) {
+	throttlers := map[string]func(GetSetter, ...Option) Throttler{
+		"token bucket": func(c GetSetter, opts ...Option) Throttler {
+			t, _ := NewTokenBucket(4, 0, c, opts...)
+			return t
+		},
+		"sliding window": func(c GetSetter, opts ...Option) Throttler {
+			t, _ := NewSlidingWindow(4, 0, c, opts...)
+			return t
+		},
+		"fixed window": func(c GetSetter, opts ...Option) Throttler {
+			t, _ := NewFixedWindow(4, 0, c, opts...)
+			return t
+		},
+	}
+	for name, constructor := range throttlers {
+		t.Run(name, func(t *testing.T) {
+			clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+			throttler := constructor(&mockGetSetter{}, WithClock(clock), WithSoftLimit(0.75))
+			expected := []bool{false, false, true, true}
+			for i, warning := range expected {
+				result := <-throttler.LinearThrottle(time.Minute, "soft")
+				if result.Error != nil || result.Delay != 0 {
+					t.Errorf("Expected call %d to pass, got %v", i, result)
+				}
+				if result.Warning != warning {
+					t.Errorf("Expected %v, got %v", warning, result.Warning)
+				}
+			}
+			if result := <-throttler.LinearThrottle(time.Minute, "soft"); !errors.Is(result.Error, ErrWouldExceedDeadline) || result.Warning {
+				t.Errorf("Expected call to be throttled at the hard limit, got %v", result)
+			}
+		})
+	}
+
+	if _, err := newOptions(WithSoftLimit(1.5)); err == nil {
+		t.Error("Expected error when passing soft limit above 1")
+	}
+}
+
+func TestWithNonBlocking(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	bucket, _ := NewTokenBucket(1, time.Hour, &mockGetSetter{}, WithClock(clock), WithNonBlocking())
+	window, _ := NewSlidingWindow(1, time.Hour, &mockGetSetter{}, WithClock(clock), WithNonBlocking())
+	leaky, _ := NewLeakyBucket(2, time.Hour, &mockGetSetter{}, WithClock(clock), WithNonBlocking())
+	throttlers := map[string]Throttler{
+		"limiter":        New(time.Hour, &mockGetSetter{}, WithClock(clock), WithNonBlocking()),
+		"token bucket":   bucket,
+		"sliding window": window,
+		"leaky bucket":   leaky,
+	}
+	for name, throttler := range throttlers {
+		t.Run(name, func(t *testing.T) {
+			if result := <-throttler.LinearThrottle(time.Minute, "non-blocking"); result.Deferred || result.Delay != 0 {
+				t.Errorf("Expected first call to pass, got %v", result)
+			}
+			// the fake clock is never advanced, so the result would never be
+			// sent in case the throttler waited
+			select {
+			case result := <-throttler.LinearThrottle(time.Minute, "non-blocking"):
+				if !result.Deferred || result.Delay != time.Minute || result.Observed != 0 {
+					t.Errorf("Expected deferred delay of %v, got %v", time.Minute, result)
+				}
+			case <-time.After(time.Second):
+				t.Error("Expected throttler not to wait")
+			}
+		})
+	}
+}
+
+func TestWithBurst(t *testing.T) {
+	tests := []struct {
+		burst         int
+		expectedFree  int
+		expectedError bool
+	}{
+		{0, 1, false},
+		{1, 1, false},
+		{3, 3, false},
+		{-1, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("burst %d", test.burst), func(t *testing.T) {
+			clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+			limiter, err := NewLimiter(time.Hour, ratelimitertest.NewRecordingCache(clock), WithClock(clock), WithBurst(test.burst))
+			if (err != nil) != test.expectedError {
+				t.Fatalf("Unexpected error value %v", err)
+			}
+			if err != nil {
+				return
+			}
+			for round := 0; round < 2; round++ {
+				for i := 0; i < test.expectedFree; i++ {
+					if ok, delay, _ := limiter.LinearAllow(time.Minute, "burst"); !ok {
+						t.Errorf("Expected call %d to pass, got %v", i, delay)
+					}
+				}
+				for i := 1; i <= 2; i++ {
+					if _, delay, _ := limiter.LinearAllow(time.Minute, "burst"); delay != time.Duration(i)*time.Minute {
+						t.Errorf("Expected %v, got %v", time.Duration(i)*time.Minute, delay)
+					}
+				}
+				// the burst is available again once the limit has expired
+				clock.Advance(time.Hour)
+			}
+		})
+	}
+}
+
+func TestWithBurst_Penalize(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter, _ := NewLimiter(time.Hour, ratelimitertest.NewRecordingCache(clock), WithClock(clock), WithBurst(3))
+	limiter.LinearAllow(time.Minute, "burst")
+	limiter.Penalize("burst", time.Minute*10)
+	limiter.LinearAllow(time.Minute, "burst")
+	limiter.LinearAllow(time.Minute, "burst")
+	if _, delay, _ := limiter.LinearAllow(time.Minute, "burst"); delay != time.Minute*11 {
+		t.Errorf("Expected %v, got %v", time.Minute*11, delay)
+	}
+}
+
+func TestWithMaxInflight(t *testing.T) {
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithMaxInflight(1))
+	<-limiter.LinearThrottle(time.Millisecond*50, "inflight")
+
+	pending := limiter.LinearThrottle(time.Millisecond*50, "inflight")
+	if result := <-limiter.LinearThrottle(time.Millisecond*50, "other"); result.Error != ErrTooManyInflight {
+		t.Errorf("Expected %v, got %v", ErrTooManyInflight, result.Error)
+	}
+	if result := <-pending; result.Error != nil {
+		t.Errorf("Unexpected error %v", result.Error)
+	}
+	if result := <-limiter.LinearThrottle(time.Millisecond*50, "other"); result.Error != nil {
+		t.Errorf("Unexpected error %v", result.Error)
+	}
+}
+
+func BenchmarkWithMaxInflight(b *testing.B) {
+	for _, max := range []int{10, 100} {
+		b.Run(fmt.Sprintf("max %d", max), func(b *testing.B) {
+			limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithMaxInflight(max))
+			baseline := runtime.NumGoroutine()
+			peak := 0
+			var results []<-chan Result
+			for i := 0; i < b.N; i++ {
+				results = append(results, limiter.LinearThrottle(time.Millisecond, "benchmark"))
+				if n := runtime.NumGoroutine() - baseline; n > peak {
+					peak = n
+				}
+			}
+			for _, r := range results {
+				<-r
+			}
+			b.ReportMetric(float64(peak), "peak-goroutines")
+		})
+	}
+}
+
+func TestWithMaxSleep(t *testing.T) {
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithMaxSleep(time.Millisecond*10))
+	<-limiter.LinearThrottle(time.Millisecond*5, "capped")
+	if result := <-limiter.LinearThrottle(time.Millisecond*5, "capped"); result.Partial || result.Delay > time.Millisecond*5 {
+		t.Errorf("Expected full delay, got %v", result)
+	}
+
+	<-limiter.LinearThrottle(time.Minute, "capped")
+	if result := <-limiter.LinearThrottle(time.Minute, "capped"); !result.Partial || result.Delay != time.Millisecond*10 {
+		t.Errorf("Expected partial delay, got %v", result)
+	}
+}
+
+func TestWithMinSleep(t *testing.T) {
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithMinSleep(time.Minute))
+	<-limiter.LinearThrottle(time.Second, "min")
+	if result := <-limiter.LinearThrottle(time.Second, "min"); result.Error != nil || result.Delay != 0 || result.Observed != 0 {
+		t.Errorf("Expected short delay to be skipped, got %v", result)
+	}
+	if delay, ok := limiter.Peek("min"); !ok || delay <= time.Second {
+		t.Errorf("Expected stored limit to be advanced, got %v", delay)
+	}
+
+	if _, err := NewLimiter(time.Hour, &mockGetSetter{}, WithMinSleep(-time.Second)); err == nil {
+		t.Error("Expected error for negative minimum sleep")
+	}
+}
+
+func BenchmarkWithMinSleep(b *testing.B) {
+	for _, min := range []time.Duration{0, time.Millisecond} {
+		b.Run(fmt.Sprintf("min %v", min), func(b *testing.B) {
+			limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithMinSleep(min))
+			for i := 0; i < b.N; i++ {
+				<-limiter.LinearThrottle(time.Microsecond*10, "benchmark")
+			}
+		})
+	}
+}
+
+func TestWithDryRun(t *testing.T) {
+	observer := &mockObserver{}
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter, _ := NewLimiter(time.Minute, &mockGetSetter{}, WithClock(clock), WithObserver(observer), WithDryRun(true))
+
+	for i := 0; i < 3; i++ {
+		if result := <-limiter.LinearThrottle(time.Minute, "dry-run"); result != (Result{}) {
+			t.Errorf("Expected empty result, got %v", result)
+		}
+	}
+	if observer.allowed != 1 || observer.throttled != 1 || observer.errors != 1 {
+		t.Errorf("Unexpected observations %d, %d, %d", observer.allowed, observer.throttled, observer.errors)
+	}
+	if delay, _ := limiter.Peek("dry-run"); delay != time.Minute*2 {
+		t.Errorf("Expected limit of %v to be stored, got %v", time.Minute*2, delay)
+	}
+}
+
+func TestSleep(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sleep(ctx, clock, time.Hour); err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if waiters := clock.Waiters(); waiters != 0 {
+		t.Errorf("Expected timer to be stopped, got %d waiters", waiters)
+	}
+}
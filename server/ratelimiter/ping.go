@@ -0,0 +1,57 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+)
+
+// Pinger can optionally be implemented by a GetSetter in order to support
+// checking whether the backing store is reachable, e.g. for readiness
+// probes.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// pingKey is read when checking caches that do not implement Pinger.
+const pingKey = "ratelimiter:ping"
+
+// ping checks whether the given cache is reachable without modifying any
+// stored limits. Caches that do not implement Pinger cannot report errors,
+// so they are considered reachable once a value could be looked up.
+func ping(ctx context.Context, cache GetSetter) error {
+	if p, ok := cache.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cache.Get(pingKey)
+	return nil
+}
+
+// Ping checks whether the cache used for storing limits is reachable.
+func (l *Limiter) Ping(ctx context.Context) error {
+	return ping(ctx, l.cache)
+}
+
+// Ping checks whether the cache used for storing limits is reachable.
+func (b *TokenBucket) Ping(ctx context.Context) error {
+	return ping(ctx, b.cache)
+}
+
+// Ping checks whether the cache used for storing limits is reachable.
+func (s *SlidingWindow) Ping(ctx context.Context) error {
+	return ping(ctx, s.cache)
+}
+
+// Ping checks whether the cache used for storing limits is reachable.
+func (b *LeakyBucket) Ping(ctx context.Context) error {
+	return ping(ctx, b.cache)
+}
+
+// Ping checks whether the cache used for storing limits is reachable.
+func (f *FixedWindow) Ping(ctx context.Context) error {
+	return ping(ctx, f.cache)
+}
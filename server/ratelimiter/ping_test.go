@@ -0,0 +1,46 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockPinger struct {
+	mockGetSetter
+	err error
+}
+
+func (m *mockPinger) Ping(ctx context.Context) error {
+	return m.err
+}
+
+func TestPing(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	pingErr := errors.New("did not work")
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		cache         GetSetter
+		expectedError error
+	}{
+		{"plain cache", context.Background(), &mockGetSetter{}, nil},
+		{"cancelled", cancelled, &mockGetSetter{}, context.Canceled},
+		{"pinger", context.Background(), &mockPinger{}, nil},
+		{"failing pinger", context.Background(), &mockPinger{err: pingErr}, pingErr},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter, _ := NewLimiter(time.Second, test.cache)
+			if err := limiter.Ping(test.ctx); err != test.expectedError {
+				t.Errorf("Expected %v, got %v", test.expectedError, err)
+			}
+		})
+	}
+}
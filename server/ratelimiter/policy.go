@@ -0,0 +1,83 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"fmt"
+	"time"
+)
+
+// FailurePolicy defines how a throttler behaves when the underlying cache
+// fails to read or store a limit.
+type FailurePolicy int
+
+const (
+	// FailClosed returns an error for calls where the limit could not be
+	// read or stored. This is the default.
+	FailClosed FailurePolicy = iota
+	// FailOpen allows calls where the limit could not be read or stored,
+	// which means limits are not enforced while the cache is failing.
+	FailOpen
+)
+
+// WithFailurePolicy defines how the throttler behaves when the underlying
+// cache fails to read or store a limit, e.g. during an outage of a remote
+// cache. Only caches implementing GetErrer or SetErrer can report such
+// failures.
+func WithFailurePolicy(p FailurePolicy) Option {
+	return func(o *options) {
+		o.failurePolicy = p
+	}
+}
+
+func (o *options) handleCacheError(err error) (time.Duration, error) {
+	if o.failurePolicy == FailOpen {
+		return 0, nil
+	}
+	return 0, fmt.Errorf("ratelimiter: error storing limit: %w", err)
+}
+
+func (o *options) handleReadError(err error) (time.Duration, error) {
+	if o.failurePolicy == FailOpen {
+		return 0, nil
+	}
+	return 0, fmt.Errorf("ratelimiter: error reading limit: %w", err)
+}
+
+// CorruptCachePolicy defines how a throttler behaves when the value stored
+// for an identifier cannot be decoded.
+type CorruptCachePolicy int
+
+const (
+	// CorruptCacheError returns ErrInvalidCache for calls where the stored
+	// value cannot be decoded. This is the default.
+	CorruptCacheError CorruptCachePolicy = iota
+	// CorruptCacheReset treats values that cannot be decoded as if no
+	// value had been stored, overwriting them with a fresh limit.
+	CorruptCacheReset
+)
+
+// WithCorruptCachePolicy defines how the throttler behaves when the value
+// stored for an identifier cannot be decoded, e.g. because other code has
+// written to the same key.
+func WithCorruptCachePolicy(p CorruptCachePolicy) Option {
+	return func(o *options) {
+		o.corruptCachePolicy = p
+	}
+}
+
+// handleInvalidValue returns an error in case the given value that could
+// not be decoded should not be replaced. Values of unknown encoding versions
+// are always replaced as if they had not been found.
+func (o *options) handleInvalidValue(value interface{}) error {
+	if data, ok := value.([]byte); ok && unknownVersion(data) {
+		o.miss()
+		return nil
+	}
+	o.corrupt()
+	if o.corruptCachePolicy == CorruptCacheReset {
+		return nil
+	}
+	return ErrInvalidCache
+}
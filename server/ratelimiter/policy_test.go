@@ -0,0 +1,149 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockFailingGetSetter struct {
+	mockGetSetter
+	err error
+}
+
+func (m *mockFailingGetSetter) SetErr(key string, value interface{}, expiry time.Duration) error {
+	return m.err
+}
+
+func (m *mockFailingGetSetter) Add(key string, value interface{}, expiry time.Duration) (bool, error) {
+	return m.err == nil, m.err
+}
+
+type mockUnreachableGetSetter struct {
+	mockGetSetter
+	err error
+}
+
+func (m *mockUnreachableGetSetter) GetErr(key string) (interface{}, bool, error) {
+	return nil, false, m.err
+}
+
+// constructors creates each of the throttlers using the given cache.
+var constructors = map[string]func(GetSetter, ...Option) Throttler{
+	"limiter": func(c GetSetter, opts ...Option) Throttler {
+		return New(time.Hour, c, opts...)
+	},
+	"token bucket": func(c GetSetter, opts ...Option) Throttler {
+		t, _ := NewTokenBucket(1, time.Hour, c, opts...)
+		return t
+	},
+	"sliding window": func(c GetSetter, opts ...Option) Throttler {
+		t, _ := NewSlidingWindow(1, time.Hour, c, opts...)
+		return t
+	},
+	"leaky bucket": func(c GetSetter, opts ...Option) Throttler {
+		t, _ := NewLeakyBucket(1, time.Hour, c, opts...)
+		return t
+	},
+}
+
+func TestWithFailurePolicy(t *testing.T) {
+	errSet := errors.New("did not work")
+	tests := []struct {
+		name          string
+		policy        FailurePolicy
+		err           error
+		expectedError error
+	}{
+		{
+			"ok",
+			FailClosed,
+			nil,
+			nil,
+		},
+		{
+			"fail closed",
+			FailClosed,
+			errSet,
+			errSet,
+		},
+		{
+			"fail open",
+			FailOpen,
+			errSet,
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter, _ := NewLimiter(
+				time.Hour,
+				&mockFailingGetSetter{err: test.err},
+				WithFailurePolicy(test.policy),
+			)
+			result := <-limiter.LinearThrottle(time.Minute, "policy")
+			if !errors.Is(result.Error, test.expectedError) {
+				t.Errorf("Expected %v, got %v", test.expectedError, result.Error)
+			}
+		})
+	}
+}
+
+func TestWithFailurePolicy_Read(t *testing.T) {
+	errGet := errors.New("did not work")
+	tests := []struct {
+		name          string
+		policy        FailurePolicy
+		expectedError error
+	}{
+		{"fail closed", FailClosed, errGet},
+		{"fail open", FailOpen, nil},
+	}
+	for name, constructor := range constructors {
+		for _, test := range tests {
+			t.Run(name+" "+test.name, func(t *testing.T) {
+				throttler := constructor(&mockUnreachableGetSetter{err: errGet}, WithFailurePolicy(test.policy))
+				for i := 0; i < 2; i++ {
+					result := <-throttler.LinearThrottle(time.Minute, "policy")
+					if !errors.Is(result.Error, test.expectedError) {
+						t.Errorf("Expected %v, got %v", test.expectedError, result.Error)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestWithCorruptCachePolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        CorruptCachePolicy
+		expectedError error
+	}{
+		{"error", CorruptCacheError, ErrInvalidCache},
+		{"reset", CorruptCacheReset, nil},
+	}
+	for name, constructor := range constructors {
+		for _, test := range tests {
+			t.Run(name+" "+test.name, func(t *testing.T) {
+				cache := &mockGetSetter{}
+				cache.Set("key", "corrupt", time.Hour)
+				throttler := constructor(
+					cache,
+					WithHasher(func([]byte) string { return "key" }),
+					WithCorruptCachePolicy(test.policy),
+				)
+				result := <-throttler.LinearThrottle(time.Minute, "corrupt")
+				if result.Error != test.expectedError {
+					t.Errorf("Expected %v, got %v", test.expectedError, result.Error)
+				}
+				if v, _ := cache.Get("key"); (v == "corrupt") != (test.expectedError != nil) {
+					t.Errorf("Unexpected value %v after throttling", v)
+				}
+			})
+		}
+	}
+}
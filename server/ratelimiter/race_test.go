@@ -0,0 +1,89 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestLimiter_CallSequence(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := ratelimitertest.NewRecordingCache(clock)
+	limiter, _ := NewLimiter(time.Hour, cache, WithClock(clock))
+	key := limiter.Key("sequence")
+
+	limiter.LinearAllow(time.Minute, "sequence")
+	limiter.LinearAllow(time.Minute, "sequence")
+
+	expected := []ratelimitertest.Call{
+		{Op: "Get", Key: key},
+		{Op: "Add", Key: key},
+		{Op: "Get", Key: key},
+		{Op: "CompareAndSwap", Key: key},
+	}
+	if calls := cache.Calls(); !reflect.DeepEqual(expected, calls) {
+		t.Errorf("Expected %v, got %v", expected, calls)
+	}
+}
+
+func TestLimiter_ConcurrentSameIdentifier(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter, _ := NewLimiter(time.Hour*24, ratelimitertest.NewRecordingCache(clock), WithClock(clock))
+
+	const calls = 50
+	var lock sync.Mutex
+	var delays []time.Duration
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, delay, err := limiter.LinearAllow(time.Minute, "concurrent")
+			if err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			lock.Lock()
+			delays = append(delays, delay)
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+	for i, delay := range delays {
+		if expected := time.Minute * time.Duration(i); delay != expected {
+			t.Errorf("Call %d: expected delay of %v, got %v", i, expected, delay)
+		}
+	}
+}
+
+func TestLimiter_ConcurrentThrottle(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter, _ := NewLimiter(time.Hour, ratelimitertest.NewRecordingCache(clock), WithClock(clock))
+
+	identifiers := []string{"a", "b", "c", "d"}
+	for _, identifier := range identifiers {
+		<-limiter.LinearThrottle(time.Minute, identifier)
+	}
+
+	var pending []<-chan Result
+	for _, identifier := range identifiers {
+		pending = append(pending, limiter.LinearThrottle(time.Minute, identifier))
+	}
+	for clock.Waiters() < len(identifiers) {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Minute)
+	for _, p := range pending {
+		if result := <-p; result.Error != nil || result.Delay != time.Minute {
+			t.Errorf("Unexpected result %v", result)
+		}
+	}
+}
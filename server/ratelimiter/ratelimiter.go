@@ -4,18 +4,56 @@
 package ratelimiter
 
 import (
-	"crypto/rand"
+	"context"
 	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"sync"
 	"time"
 )
 
 var (
-	errInvalidCache        = errors.New("ratelimiter: invalid value in cache")
-	errWouldExceedDeadline = errors.New("ratelimiter: applicable rate limit would exceed give deadline")
+	// ErrInvalidCache is returned when the value stored for an identifier
+	// cannot be read.
+	ErrInvalidCache = errors.New("ratelimiter: invalid value in cache")
+	// ErrWouldExceedDeadline is matched by the DeadlineExceededError
+	// returned when the delay required for satisfying the rate limit would
+	// exceed the configured timeout.
+	ErrWouldExceedDeadline = errors.New("ratelimiter: applicable rate limit would exceed give deadline")
+	// ErrInvalidCost is returned when throttling using a cost smaller than 1.
+	ErrInvalidCost = errors.New("ratelimiter: cost must be at least 1")
+	// ErrInvalidThreshold is returned when throttling using a threshold
+	// that is not positive, which would never delay any call.
+	ErrInvalidThreshold  = errors.New("ratelimiter: threshold must be positive")
+	errDeleteUnsupported = errors.New("ratelimiter: cache does not support deleting values")
 )
 
+// DeadlineExceededError is returned when the delay required for satisfying
+// the rate limit would exceed the deadline. It carries the key the limit is
+// stored at instead of the identifier, so it can be logged without leaking
+// identifiers. It matches ErrWouldExceedDeadline when using errors.Is.
+type DeadlineExceededError struct {
+	Key       string
+	Remaining time.Duration
+	Deadline  time.Duration
+}
+
+func (d *DeadlineExceededError) Error() string {
+	return fmt.Sprintf("%v: %s would need to wait for %v, deadline is %v", ErrWouldExceedDeadline, d.Key, d.Remaining, d.Deadline)
+}
+
+// Unwrap returns ErrWouldExceedDeadline.
+func (d *DeadlineExceededError) Unwrap() error {
+	return ErrWouldExceedDeadline
+}
+
+func deadlineExceeded(key string, remaining, deadline time.Duration) error {
+	return &DeadlineExceededError{Key: key, Remaining: remaining, Deadline: deadline}
+}
+
 // GetSetter needs to be implemented by any cache that is
 // to be used for storing limits
 type GetSetter interface {
@@ -23,107 +61,635 @@ type GetSetter interface {
 	Set(key string, value interface{}, expiry time.Duration)
 }
 
+// CompareAndSwapper can optionally be implemented by a GetSetter. If it is,
+// the limiter uses it to atomically update stored limits so that concurrent
+// calls for the same identifier cannot overwrite each other.
+type CompareAndSwapper interface {
+	CompareAndSwap(key string, old, new interface{}, expiry time.Duration) bool
+}
+
+// Adder can optionally be implemented by a GetSetter. If it is, throttlers
+// use it to atomically store the first limit for an identifier, so that
+// concurrent first calls do not all pass. Add is expected to store the value
+// only in case no value exists for the given key and to report whether the
+// value has been stored.
+type Adder interface {
+	Add(key string, value interface{}, expiry time.Duration) (bool, error)
+}
+
+// GetErrer can optionally be implemented by a GetSetter that can fail to
+// read values, e.g. because it talks to a remote store. Errors returned
+// are handled according to the configured FailurePolicy.
+type GetErrer interface {
+	GetErr(key string) (interface{}, bool, error)
+}
+
+// SetErrer can optionally be implemented by a GetSetter that can fail to
+// store values, e.g. because it talks to a remote store. Errors returned
+// are handled according to the configured FailurePolicy.
+type SetErrer interface {
+	SetErr(key string, value interface{}, expiry time.Duration) error
+}
+
+// Deleter can optionally be implemented by a GetSetter in order to support
+// removing stored limits.
+type Deleter interface {
+	Delete(key string)
+}
+
 // Throttler needs to be implemented by any rate limiter
 type Throttler interface {
 	LinearThrottle(threshold time.Duration, identifier string) <-chan Result
 	ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result
 }
 
+// ContextThrottler is implemented by throttlers that stop waiting as soon
+// as the context passed when throttling is cancelled, like all throttlers
+// in this package. Use LinearThrottleCtx and ExponentialThrottleCtx for
+// passing a context to any Throttler.
+type ContextThrottler interface {
+	Throttler
+	LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result
+	ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result
+}
+
+// LinearThrottleCtx linearly throttles the given identifier using the given
+// Throttler, passing on the context in case it implements ContextThrottler.
+// For other throttlers, the returned channel yields the context's error as
+// soon as it is cancelled, while the throttler keeps waiting.
+func LinearThrottleCtx(ctx context.Context, t Throttler, threshold time.Duration, identifier string) <-chan Result {
+	if c, ok := t.(ContextThrottler); ok {
+		return c.LinearThrottleCtx(ctx, threshold, identifier)
+	}
+	return withContext(ctx, t.LinearThrottle(threshold, identifier))
+}
+
+// ExponentialThrottleCtx works like LinearThrottleCtx but throttles using
+// exponentially increasing thresholds.
+func ExponentialThrottleCtx(ctx context.Context, t Throttler, threshold time.Duration, identifier string) <-chan Result {
+	if c, ok := t.(ContextThrottler); ok {
+		return c.ExponentialThrottleCtx(ctx, threshold, identifier)
+	}
+	return withContext(ctx, t.ExponentialThrottle(threshold, identifier))
+}
+
 // Limiter can be used to rate limit operations
 // based on an identifier and a threshold value
 type Limiter struct {
-	timeout time.Duration
-	cache   GetSetter
-	salt    []byte
+	options
+	cache             GetSetter
+	saltLock          sync.RWMutex
+	previousSalt      []byte
+	previousSaltUntil time.Time
+	idempotencyLocks  [16]sync.Mutex
 }
 
-// Result describes the outcome of a `Throttle` call
+// Result describes the outcome of a `Throttle` call. In case the rate limit
+// would exceed the deadline, Delay contains the delay that would have
+// been required. Partial is set in case the caller did not wait for the
+// full delay required because of WithMaxSleep. RetryAt is the time at
+// which the call was or will be allowed as computed at the time of the
+// decision. It is zero if the call was allowed without any delay.
+// Observed is the time the caller actually spent waiting as measured by
+// the clock, which can exceed Delay e.g. under scheduler pressure.
+// Warning is set in case the call used up the budget beyond the soft limit
+// set using WithSoftLimit. Deferred is set in case the throttler did not
+// wait for Delay because of WithNonBlocking, so the caller needs to.
+// Source names the limit that produced the delay or error, which is the
+// namespace set using WithNamespace for plain throttlers. Composite
+// throttlers like Chain, Hierarchical and GlobalCap pass on the source of
+// the limit governing the result.
 type Result struct {
-	Error error
-	Delay time.Duration
+	Error    error
+	Delay    time.Duration
+	Partial  bool
+	RetryAt  time.Time
+	Observed time.Duration
+	Warning  bool
+	Deferred bool
+	Source   string
 }
 
-func (l *Limiter) hash(s string) string {
-	joined := append([]byte(s), l.salt...)
-	return fmt.Sprintf("%x", sha256.Sum256(joined))
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
 }
 
+// cacheItem stores the time until which calls for an identifier are
+// blocked. updatedAt is the time of the last update, which allows
+// detecting the clock having been set back since. burst is the number of
+// calls that can still be made without delay as set using WithBurst.
 type cacheItem struct {
 	blockUntil time.Time
 	queueLen   int64
+	updatedAt  time.Time
+	deadline   time.Duration
+	burst      int64
+}
+
+// retain returns the expiry to use when storing the item. Items carrying a
+// deadline set using SetDeadline are kept for at least deadlineRetention,
+// so the deadline is not lost as soon as the limit has passed.
+func (c cacheItem) retain(expiry time.Duration) time.Duration {
+	if c.deadline > 0 && expiry < deadlineRetention {
+		return deadlineRetention
+	}
+	return expiry
+}
+
+// rebase returns the item so that it keeps the delay that remained when
+// it was last updated in case the clock has been set back since. Otherwise
+// calls would be blocked for the additional duration the clock has been
+// set back by.
+func (c cacheItem) rebase(now time.Time) cacheItem {
+	if c.updatedAt.IsZero() || !now.Before(c.updatedAt) {
+		return c
+	}
+	c.blockUntil = now.Add(c.blockUntil.Sub(c.updatedAt))
+	c.updatedAt = now
+	return c
 }
 
 // LinearThrottle returns a channel that blocks until the configured
 // rate limit has been satisfied. The channel will send a `Result` exactly
 // once before closing, containing information on the
-// applied rate limiting or possible errors that occured
+// applied rate limiting or possible errors that occured.
+//
+// The threshold is passed per call, so callers can apply different limits
+// to different identifiers, e.g. depending on a user's plan. In case
+// varying thresholds are used with the same identifier, the threshold of
+// each call defines the distance the subsequent call has to keep.
 func (l *Limiter) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
-	return l.throttle(threshold, identifier, false)
+	return l.LinearThrottleCtx(context.Background(), threshold, identifier)
 }
 
 // ExponentialThrottle throttles using exponentially increasing thresholds
 func (l *Limiter) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
-	return l.throttle(threshold, identifier, true)
+	return l.ExponentialThrottleCtx(context.Background(), threshold, identifier)
 }
 
-func (l *Limiter) throttle(threshold time.Duration, identifier string, exponential bool) <-chan Result {
-	hashedIdentifier := l.hash(identifier)
+// LinearThrottleCtx works like LinearThrottle, but stops waiting as soon as
+// the given context is cancelled. In this case, the `Result` carries the
+// context's error.
+func (l *Limiter) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return l.throttle(ctx, threshold, identifier, false, 0)
+}
 
-	out := make(chan Result)
-	go func() {
-		if value, found := l.cache.Get(hashedIdentifier); found {
-			if item, ok := value.(cacheItem); ok {
-				remaining := time.Until(item.blockUntil)
-				if remaining > l.timeout {
-					out <- Result{Error: errWouldExceedDeadline}
-					return
-				}
-
-				factor := time.Duration(1)
-				if exponential {
-					factor = time.Duration(item.queueLen)
-				}
-
-				l.cache.Set(
-					hashedIdentifier,
-					cacheItem{
-						blockUntil: item.blockUntil.Add(
-							threshold * factor,
-						),
-						queueLen: item.queueLen + 1,
-					},
-					remaining,
-				)
-				time.Sleep(remaining)
-				out <- Result{Delay: remaining}
-			} else {
-				out <- Result{Error: errInvalidCache}
+// ExponentialThrottleCtx works like ExponentialThrottle, but stops waiting as
+// soon as the given context is cancelled.
+func (l *Limiter) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return l.throttle(ctx, threshold, identifier, true, 0)
+}
+
+// LinearThrottleCancelable works like LinearThrottle, but also returns a
+// function that stops waiting when called, in which case the `Result`
+// carries context.Canceled. Calling the function after the result has been
+// sent has no effect.
+func (l *Limiter) LinearThrottleCancelable(threshold time.Duration, identifier string) (<-chan Result, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	return l.LinearThrottleCtx(ctx, threshold, identifier), cancel
+}
+
+// ExponentialThrottleCancelable works like ExponentialThrottle, but also
+// returns a function that stops waiting like LinearThrottleCancelable.
+func (l *Limiter) ExponentialThrottleCancelable(threshold time.Duration, identifier string) (<-chan Result, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	return l.ExponentialThrottleCtx(ctx, threshold, identifier), cancel
+}
+
+// LinearThrottleWithTimeout works like LinearThrottle, but rejects calls
+// that would need to wait longer than maxWait instead of the timeout the
+// Limiter has been created with, so different call sites can choose their
+// own tolerance. A non-positive maxWait falls back to the Limiter's timeout.
+func (l *Limiter) LinearThrottleWithTimeout(threshold time.Duration, identifier string, maxWait time.Duration) <-chan Result {
+	return l.throttle(context.Background(), threshold, identifier, false, maxWait)
+}
+
+// ExponentialThrottleWithTimeout works like ExponentialThrottle, but uses
+// the given maxWait like LinearThrottleWithTimeout.
+func (l *Limiter) ExponentialThrottleWithTimeout(threshold time.Duration, identifier string, maxWait time.Duration) <-chan Result {
+	return l.throttle(context.Background(), threshold, identifier, true, maxWait)
+}
+
+// timeoutFor returns the timeout applying to a call using the given maxWait
+// for which the given item is stored. A positive maxWait takes precedence
+// over a deadline stored using SetDeadline, which takes precedence over the
+// Limiter's timeout.
+func (l *Limiter) timeoutFor(item cacheItem, maxWait time.Duration) time.Duration {
+	switch {
+	case maxWait > 0:
+		return maxWait
+	case item.deadline > 0:
+		return item.deadline
+	default:
+		return l.timeout
+	}
+}
+
+// LinearThrottleCost works like LinearThrottle, but advances the limit by
+// `cost` times the threshold, so expensive operations push out subsequent
+// calls further. Costs smaller than 1 are rejected using ErrInvalidCost.
+func (l *Limiter) LinearThrottleCost(threshold time.Duration, identifier string, cost int) <-chan Result {
+	return l.throttleCost(threshold, identifier, cost, false)
+}
+
+// ExponentialThrottleCost works like ExponentialThrottle, but advances the
+// limit by `cost` times the exponentially increased threshold.
+func (l *Limiter) ExponentialThrottleCost(threshold time.Duration, identifier string, cost int) <-chan Result {
+	return l.throttleCost(threshold, identifier, cost, true)
+}
+
+func (l *Limiter) throttleCost(threshold time.Duration, identifier string, cost int, exponential bool) <-chan Result {
+	if cost < 1 {
+		hashedIdentifier := l.key(identifier)
+		return l.run(context.Background(), hashedIdentifier, func() (time.Duration, error) {
+			return 0, ErrInvalidCost
+		})
+	}
+	return l.throttle(context.Background(), threshold*time.Duration(cost), identifier, exponential, 0)
+}
+
+// LinearAllowCost performs the same checks and updates as
+// LinearThrottleCost but never blocks, just like LinearAllow.
+func (l *Limiter) LinearAllowCost(threshold time.Duration, identifier string, cost int) (bool, time.Duration, error) {
+	if cost < 1 {
+		hashedIdentifier := l.key(identifier)
+		_, err := l.check(hashedIdentifier, func() (time.Duration, error) {
+			return 0, ErrInvalidCost
+		})
+		return false, 0, err
+	}
+	return l.allowNow(threshold*time.Duration(cost), identifier, false)
+}
+
+// LinearAllow performs the same checks and updates as LinearThrottle but
+// never blocks. In case the call would be throttled, false is returned
+// alongside the delay the caller is required to wait for before proceeding.
+// The slot is reserved nonetheless, so subsequent calls are delayed further.
+func (l *Limiter) LinearAllow(threshold time.Duration, identifier string) (bool, time.Duration, error) {
+	return l.allowNow(threshold, identifier, false)
+}
+
+// ExponentialAllow performs the same checks and updates as
+// ExponentialThrottle but never blocks.
+func (l *Limiter) ExponentialAllow(threshold time.Duration, identifier string) (bool, time.Duration, error) {
+	return l.allowNow(threshold, identifier, true)
+}
+
+func (l *Limiter) allowNow(threshold time.Duration, identifier string, exponential bool) (bool, time.Duration, error) {
+	hashedIdentifier := l.key(identifier)
+	delay, err := l.check(hashedIdentifier, l.guard(l.cache, hashedIdentifier, func() (time.Duration, error) {
+		return l.allow(threshold, hashedIdentifier, exponential, 0)
+	}))
+	return err == nil && delay == 0, delay, err
+}
+
+// LinearAllowN checks whether n consecutive calls using the given identifier
+// can be made without any of them exceeding the timeout. If so, the slots
+// for all n calls are reserved and true is returned alongside the delay the
+// caller needs to wait for before making the first call. Otherwise nothing
+// is reserved and the returned delay is the time to wait before all n calls
+// would fit.
+func (l *Limiter) LinearAllowN(threshold time.Duration, identifier string, n int) (bool, time.Duration, error) {
+	return l.allowN(threshold, identifier, n, false)
+}
+
+// ExponentialAllowN works like LinearAllowN but reserves slots using
+// exponentially increasing thresholds.
+func (l *Limiter) ExponentialAllowN(threshold time.Duration, identifier string, n int) (bool, time.Duration, error) {
+	return l.allowN(threshold, identifier, n, true)
+}
+
+func (l *Limiter) allowN(threshold time.Duration, identifier string, n int, exponential bool) (bool, time.Duration, error) {
+	hashedIdentifier := l.key(identifier)
+	var ok bool
+	delay, err := l.check(hashedIdentifier, l.guard(l.cache, hashedIdentifier, func() (time.Duration, error) {
+		var delay time.Duration
+		var err error
+		ok, delay, err = l.reserve(threshold, hashedIdentifier, n, exponential)
+		return delay, err
+	}))
+	// calls passed using WithDryRun are reported without any delay
+	return err == nil && (ok || delay == 0), delay, err
+}
+
+func (l *Limiter) reserve(threshold time.Duration, hashedIdentifier string, n int, exponential bool) (bool, time.Duration, error) {
+	if n < 1 {
+		return false, 0, ErrInvalidCost
+	}
+	if threshold <= 0 {
+		return false, 0, ErrInvalidThreshold
+	}
+	for {
+		now := l.clock.Now()
+		value, found, err := getErr(l.cache, hashedIdentifier)
+		if err != nil {
+			_, err := l.handleReadError(err)
+			return err == nil, 0, err
+		}
+		var previous interface{}
+		if found {
+			previous = value
+		} else {
+			l.miss()
+		}
+		if remaining, ok := l.blocked(value); found && ok {
+			if remaining > 0 {
+				l.hit()
+				return false, remaining, blockedError(hashedIdentifier, value)
 			}
+			l.miss()
+			found, previous = false, replace
+		}
+		item, ok := decodeCacheItem(value)
+		if found && !ok {
+			if err := l.handleInvalidValue(value); err != nil {
+				return false, 0, err
+			}
+			found, previous = false, replace
+		}
+		if found {
+			l.hit()
+			item = item.rebase(now)
 		} else {
-			l.cache.Set(hashedIdentifier, cacheItem{
-				blockUntil: time.Now().Add(threshold),
+			item = cacheItem{}
+		}
+		item.updatedAt = now
+		if item.blockUntil.Before(now) {
+			item.blockUntil, item.queueLen = now, 0
+		}
+
+		timeout := l.timeoutFor(item, 0)
+		first := item.blockUntil.Sub(now)
+		for i := 0; i < n; i++ {
+			if wait := item.blockUntil.Sub(now); wait > timeout {
+				return false, wait - timeout, nil
+			}
+			factor := time.Duration(1)
+			if exponential && item.queueLen > 1 {
+				factor = time.Duration(item.queueLen)
+			}
+			item.blockUntil = item.blockUntil.Add(threshold * factor)
+			item.queueLen++
+		}
+
+		ok, err = update(l.cache, hashedIdentifier, previous, item, item.retain(item.blockUntil.Sub(now)))
+		if err != nil {
+			_, err := l.handleCacheError(err)
+			return err == nil, first, err
+		}
+		if ok {
+			return true, first, nil
+		}
+	}
+}
+
+// Key returns the cache key the limit for the given identifier is stored
+// at using the current salt, e.g. for looking up or removing entries in a
+// shared cache. The salt itself is never exposed.
+func (l *Limiter) Key(identifier string) string {
+	return l.hash(identifier)
+}
+
+// Peek returns the delay a call using the given identifier would currently
+// be throttled by, without updating the stored limit. Limits stored using a
+// previous salt that is still in its grace period are taken into account.
+func (l *Limiter) Peek(identifier string) (time.Duration, bool) {
+	_, value, found := l.lookup(identifier)
+	if !found {
+		return 0, false
+	}
+	if remaining, ok := l.blocked(value); ok {
+		if remaining <= 0 {
+			return 0, false
+		}
+		return remaining, true
+	}
+	item, ok := decodeCacheItem(value)
+	if !ok {
+		return 0, false
+	}
+	now := l.clock.Now()
+	remaining := item.rebase(now).blockUntil.Sub(now)
+	if remaining <= 0 {
+		return 0, false
+	}
+	return remaining, true
+}
+
+// Reset removes any limit and circuit breaker state stored for the given
+// identifier, so the next call using the identifier will not be throttled.
+// It returns an error in case the underlying cache does not implement
+// Deleter.
+func (l *Limiter) Reset(identifier string) error {
+	d, ok := l.cache.(Deleter)
+	if !ok {
+		return errDeleteUnsupported
+	}
+	key := l.key(identifier)
+	d.Delete(key)
+	d.Delete(breakerKey(key))
+	return nil
+}
+
+func (l *Limiter) throttle(ctx context.Context, threshold time.Duration, identifier string, exponential bool, maxWait time.Duration) <-chan Result {
+	hashedIdentifier := l.key(identifier)
+	return l.run(ctx, hashedIdentifier, l.guard(l.cache, hashedIdentifier, func() (time.Duration, error) {
+		return l.allow(threshold, hashedIdentifier, exponential, maxWait)
+	}))
+}
+
+// allow updates the limit for the given key and returns the delay
+// the caller needs to wait for before proceeding. Delays exceeding
+// the applicable timeout are rejected, see timeoutFor.
+func (l *Limiter) allow(threshold time.Duration, hashedIdentifier string, exponential bool, maxWait time.Duration) (time.Duration, error) {
+	if threshold <= 0 {
+		return 0, ErrInvalidThreshold
+	}
+	for {
+		value, found, err := getErr(l.cache, hashedIdentifier)
+		if err != nil {
+			return l.handleReadError(err)
+		}
+		var previous interface{}
+		if found {
+			previous = value
+		} else {
+			l.miss()
+		}
+		if remaining, ok := l.blocked(value); found && ok {
+			if remaining > 0 {
+				l.hit()
+				return remaining, blockedError(hashedIdentifier, value)
+			}
+			l.miss()
+			found, previous = false, replace
+		}
+		item, ok := decodeCacheItem(value)
+		if found && !ok {
+			if err := l.handleInvalidValue(value); err != nil {
+				return 0, err
+			}
+			// invalid values cannot be compared safely, so they are
+			// replaced as if nothing had been stored
+			found, previous = false, replace
+		}
+		if found {
+			l.hit()
+		}
+		now := l.clock.Now()
+		if !found {
+			initial := threshold + l.spread()
+			ok, err := update(l.cache, hashedIdentifier, previous, cacheItem{
+				blockUntil: now.Add(initial),
 				queueLen:   1,
-			}, threshold)
-			out <- Result{}
+				updatedAt:  now,
+				burst:      l.burst(),
+			}, initial)
+			if err != nil {
+				return l.handleCacheError(err)
+			}
+			if ok {
+				return 0, nil
+			}
+			continue
 		}
-		close(out)
-	}()
-	return out
+
+		item = item.rebase(now)
+		if item.burst > 0 {
+			// calls within the burst allowance pass without delay, so
+			// only the call following the burst keeps its distance.
+			// Delays beyond that, e.g. caused by Penalize, are kept.
+			blockUntil := now.Add(threshold)
+			if item.blockUntil.After(blockUntil) {
+				blockUntil = item.blockUntil
+			}
+			next := cacheItem{
+				blockUntil: blockUntil,
+				queueLen:   1,
+				updatedAt:  now,
+				deadline:   item.deadline,
+				burst:      item.burst - 1,
+			}
+			ok, err := update(l.cache, hashedIdentifier, value, next, next.retain(blockUntil.Sub(now)))
+			if err != nil {
+				return l.handleCacheError(err)
+			}
+			if ok {
+				return 0, nil
+			}
+			continue
+		}
+		if !item.blockUntil.After(now) {
+			// limits that have passed are only still stored when
+			// carrying a deadline, and are continued like new ones
+			item.blockUntil, item.queueLen = now, 0
+		}
+		remaining := item.blockUntil.Sub(now)
+		if timeout := l.timeoutFor(item, maxWait); remaining > timeout {
+			return remaining, deadlineExceeded(hashedIdentifier, remaining, timeout)
+		}
+
+		factor := time.Duration(1)
+		if exponential && item.queueLen > 1 {
+			factor = time.Duration(item.queueLen)
+		}
+
+		next := cacheItem{
+			blockUntil: item.blockUntil.Add(
+				threshold * factor,
+			),
+			queueLen:  item.queueLen + 1,
+			updatedAt: now,
+			deadline:  item.deadline,
+		}
+		ok, err = update(l.cache, hashedIdentifier, value, next, next.retain(remaining))
+		if err != nil {
+			return l.handleCacheError(err)
+		}
+		if ok {
+			return remaining, nil
+		}
+		// another caller updated the entry in the meantime, so the
+		// computation needs to be repeated using the new value
+	}
+}
+
+// getErr reads the value stored for the given key, returning errors in
+// case the cache implements GetErrer.
+func getErr(cache GetSetter, key string) (interface{}, bool, error) {
+	if g, ok := cache.(GetErrer); ok {
+		return g.GetErr(key)
+	}
+	value, found := cache.Get(key)
+	return value, found, nil
+}
+
+// replace can be passed to update as the previous value for replacing the
+// stored value unconditionally, e.g. because it cannot be decoded.
+var replace = &struct{}{}
+
+// update stores the next value for the given key. A nil previous value
+// signals that no value has been stored before. In case the cache supports
+// atomic updates, false is returned if the stored value does not equal
+// the given previous value anymore or if a value has been stored in the
+// meantime. The previous value is expected to be passed exactly as returned
+// by the cache.
+func update(cache GetSetter, key string, previous, next interface{}, expiry time.Duration) (bool, error) {
+	switch previous {
+	case nil:
+		if a, ok := cache.(Adder); ok {
+			return a.Add(key, next, expiry)
+		}
+	case replace:
+	default:
+		if cas, ok := cache.(CompareAndSwapper); ok {
+			return cas.CompareAndSwap(key, previous, next, expiry), nil
+		}
+	}
+	if s, ok := cache.(SetErrer); ok {
+		if err := s.SetErr(key, next, expiry); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	cache.Set(key, next, expiry)
+	return true, nil
 }
 
-// New creates a new Throttler using Limiter. `threshold` defines the
-// enforced minimum distance between two calls of the
-// instance's `Throttle` method using the same identifier
-func New(timeout time.Duration, cache GetSetter) Throttler {
-	salt, err := randomBytes(16)
+// New creates a new Throttler using Limiter. `timeout` defines the
+// maximum delay a caller of the instance's throttling methods will be
+// asked to wait for before an error is returned instead. New panics in case
+// the limiter cannot be initialized, callers that want to handle such
+// errors should use NewLimiter instead.
+func New(timeout time.Duration, cache GetSetter, opts ...Option) Throttler {
+	l, err := NewLimiter(timeout, cache, opts...)
 	if err != nil {
 		panic("cannot initialize rate limiter")
 	}
+	return l
+}
+
+// NewLimiter creates a new Limiter just like New does, but returns an error
+// in case the limiter cannot be initialized.
+func NewLimiter(timeout time.Duration, cache GetSetter, opts ...Option) (*Limiter, error) {
+	return NewWithOptions(cache, append([]Option{WithTimeout(timeout)}, opts...)...)
+}
+
+// NewWithOptions creates a new Limiter using the given cache, configured
+// by the given options. `WithTimeout` is required.
+func NewWithOptions(cache GetSetter, opts ...Option) (*Limiter, error) {
+	o, err := newOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if o.timeout <= 0 {
+		return nil, errors.New("ratelimiter: a positive timeout is required")
+	}
 	return &Limiter{
+		options: o,
 		cache:   cache,
-		timeout: timeout,
-		salt:    salt,
-	}
+	}, nil
 }
 
 // NoopRatelimiter implements Throttler without ever blocking
@@ -139,6 +705,21 @@ func (l *NoopRatelimiter) ExponentialThrottle(threshold time.Duration, identifie
 	return l.pass()
 }
 
+// LinearThrottleCtx immediately returns an empty result
+func (l *NoopRatelimiter) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return l.pass()
+}
+
+// ExponentialThrottleCtx immediately returns an empty result
+func (l *NoopRatelimiter) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return l.pass()
+}
+
+// Close immediately returns as there is nothing to wait for
+func (l *NoopRatelimiter) Close(ctx context.Context) error {
+	return nil
+}
+
 func (l *NoopRatelimiter) pass() <-chan Result {
 	out := make(chan Result)
 	go func() {
@@ -153,11 +734,20 @@ func NewNoopRateLimiter() Throttler {
 	return &NoopRatelimiter{}
 }
 
-func randomBytes(size int) ([]byte, error) {
+func randomBytes(r io.Reader, size int) ([]byte, error) {
 	b := make([]byte, size)
-	_, err := rand.Read(b)
+	_, err := io.ReadFull(r, b)
 	if err != nil {
 		return nil, fmt.Errorf("ratelimiter: error reading random bytes: %w", err)
 	}
 	return b, nil
 }
+
+// randomFloat returns a random number in the range [0, 1)
+func randomFloat(r io.Reader) (float64, error) {
+	b, err := randomBytes(r, 8)
+	if err != nil {
+		return 0, err
+	}
+	return float64(binary.BigEndian.Uint64(b)>>11) / (1 << 53), nil
+}
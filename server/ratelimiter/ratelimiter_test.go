@@ -4,10 +4,14 @@
 package ratelimiter
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
 )
 
 type mockGetSetter struct {
@@ -43,6 +47,36 @@ func (m *mockGetSetter) Set(key string, v interface{}, expiry time.Duration) {
 	m.values[key] = value{v, time.Now().Add(expiry)}
 }
 
+func (m *mockGetSetter) Add(key string, v interface{}, expiry time.Duration) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if existing, ok := m.values[key]; ok && time.Now().Before(existing.expiry) {
+		return false, nil
+	}
+	if m.values == nil {
+		m.values = map[string]value{}
+	}
+	m.values[key] = value{v, time.Now().Add(expiry)}
+	return true, nil
+}
+
+func (m *mockGetSetter) CompareAndSwap(key string, old, new interface{}, expiry time.Duration) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	v, ok := m.values[key]
+	if !ok || time.Now().After(v.expiry) || v.value != old {
+		return false
+	}
+	m.values[key] = value{new, time.Now().Add(expiry)}
+	return true
+}
+
+func (m *mockGetSetter) Delete(key string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.values, key)
+}
+
 func TestLinearThrottle(t *testing.T) {
 	tests := []struct {
 		name               string
@@ -76,6 +110,507 @@ func TestLinearThrottle(t *testing.T) {
 	}
 }
 
+func TestLinearThrottle_Concurrent(t *testing.T) {
+	cache := &mockGetSetter{}
+	limiter := New(time.Hour, cache)
+	threshold := time.Millisecond * 10
+
+	<-limiter.LinearThrottle(threshold, "concurrent")
+	key := limiter.(*Limiter).hash("concurrent")
+	initial := cache.values[key].value.(cacheItem)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if result := <-limiter.LinearThrottle(threshold, "concurrent"); result.Error != nil {
+				t.Errorf("Unexpected error %v", result.Error)
+			}
+		}()
+	}
+	wg.Wait()
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	final := cache.values[key].value.(cacheItem)
+	if final.queueLen != 101 {
+		t.Errorf("Expected queue length of 101, got %d", final.queueLen)
+	}
+	if total := final.blockUntil.Sub(initial.blockUntil); total != threshold*100 {
+		t.Errorf("Expected total delay of %v, got %v", threshold*100, total)
+	}
+}
+
+func TestLinearThrottleCtx(t *testing.T) {
+	t.Run("cancelled", func(t *testing.T) {
+		limiter, _ := NewLimiter(time.Hour, &mockGetSetter{})
+		<-limiter.LinearThrottle(time.Minute, "cancelled")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		result := limiter.LinearThrottleCtx(ctx, time.Minute, "cancelled")
+		cancel()
+
+		select {
+		case r := <-result:
+			if !errors.Is(r.Error, context.Canceled) {
+				t.Errorf("Expected context.Canceled, got %v", r.Error)
+			}
+		case <-time.After(time.Second):
+			t.Error("Expected result after cancellation, got none")
+		}
+	})
+	t.Run("not cancelled", func(t *testing.T) {
+		limiter, _ := NewLimiter(time.Hour, &mockGetSetter{})
+		<-limiter.LinearThrottle(time.Millisecond*10, "not cancelled")
+
+		result := <-limiter.LinearThrottleCtx(context.Background(), time.Millisecond*10, "not cancelled")
+		if result.Error != nil {
+			t.Errorf("Unexpected error %v", result.Error)
+		}
+		if result.Delay <= 0 {
+			t.Errorf("Expected positive delay, got %v", result.Delay)
+		}
+	})
+}
+
+// blockingThrottler implements Throttler without supporting contexts and
+// never yields a result.
+type blockingThrottler struct{}
+
+func (blockingThrottler) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return make(chan Result)
+}
+
+func (blockingThrottler) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return make(chan Result)
+}
+
+func TestLinearThrottleCtx_Throttler(t *testing.T) {
+	if _, ok := interface{}(blockingThrottler{}).(ContextThrottler); ok {
+		t.Fatal("Unexpected implementation of ContextThrottler")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	result := LinearThrottleCtx(ctx, blockingThrottler{}, time.Minute, "blocking")
+	cancel()
+
+	select {
+	case r := <-result:
+		if !errors.Is(r.Error, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", r.Error)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected result after cancellation, got none")
+	}
+}
+
+func TestLimiter_LinearThrottleCancelable(t *testing.T) {
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{})
+
+	result, cancel := limiter.LinearThrottleCancelable(time.Hour, "cancelable")
+	if r := <-result; r.Error != nil {
+		t.Errorf("Unexpected error %v", r.Error)
+	}
+	cancel()
+
+	result, cancel = limiter.LinearThrottleCancelable(time.Hour, "cancelable")
+	cancel()
+	if r := <-result; r.Error != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, r.Error)
+	}
+	cancel()
+}
+
+func TestLimiter_LinearAllow(t *testing.T) {
+	limiter := New(time.Hour, &mockGetSetter{}).(*Limiter)
+
+	ok, delay, err := limiter.LinearAllow(time.Minute, "allow")
+	if !ok || delay != 0 || err != nil {
+		t.Errorf("Expected first call to be allowed, got %v, %v, %v", ok, delay, err)
+	}
+
+	ok, delay, err = limiter.LinearAllow(time.Minute, "allow")
+	if ok || delay <= 0 || delay > time.Minute || err != nil {
+		t.Errorf("Expected second call to be delayed, got %v, %v, %v", ok, delay, err)
+	}
+
+	ok, delay, err = limiter.LinearAllow(time.Minute, "allow")
+	if ok || delay <= time.Minute || err != nil {
+		t.Errorf("Expected third call to be delayed further, got %v, %v, %v", ok, delay, err)
+	}
+}
+
+func TestLimiter_WithClock(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter := New(time.Hour, &mockGetSetter{}, WithClock(clock))
+
+	if result := <-limiter.LinearThrottle(time.Minute, "clock"); result.Delay != 0 {
+		t.Errorf("Expected no delay, got %v", result.Delay)
+	}
+
+	clock.Advance(time.Second * 20)
+	pending := limiter.LinearThrottle(time.Minute, "clock")
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second * 40)
+
+	if result := <-pending; result.Delay != time.Second*40 {
+		t.Errorf("Expected delay of %v, got %v", time.Second*40, result.Delay)
+	}
+}
+
+func TestLimiter_Observed(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithClock(clock))
+
+	if result := <-limiter.LinearThrottle(time.Minute, "observed"); result.Observed != 0 {
+		t.Errorf("Expected no observed delay, got %v", result.Observed)
+	}
+
+	pending := limiter.LinearThrottle(time.Minute, "observed")
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Minute * 2)
+
+	result := <-pending
+	if result.Delay != time.Minute {
+		t.Errorf("Expected delay of %v, got %v", time.Minute, result.Delay)
+	}
+	if result.Observed != time.Minute*2 {
+		t.Errorf("Expected observed delay of %v, got %v", time.Minute*2, result.Observed)
+	}
+}
+
+func TestLimiter_ClockSetBack(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithClock(clock))
+
+	limiter.LinearAllow(time.Minute, "clock")
+	clock.Advance(-time.Hour * 24)
+
+	if remaining, _ := limiter.Peek("clock"); remaining > time.Minute {
+		t.Errorf("Expected remaining delay to be bounded by %v, got %v", time.Minute, remaining)
+	}
+	_, delay, err := limiter.LinearAllow(time.Minute, "clock")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if delay > time.Minute {
+		t.Errorf("Expected delay to be bounded by %v, got %v", time.Minute, delay)
+	}
+}
+
+func TestNewLimiter(t *testing.T) {
+	limiter, err := NewLimiter(time.Hour, &mockGetSetter{})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(limiter.salt) != 16 {
+		t.Errorf("Expected salt of 16 bytes, got %d", len(limiter.salt))
+	}
+
+	if _, err := NewLimiter(0, &mockGetSetter{}); err == nil {
+		t.Error("Expected error when passing zero timeout")
+	}
+}
+
+func TestInvalidThreshold(t *testing.T) {
+	window, _ := NewFixedWindow(1, time.Hour, &mockGetSetter{})
+	throttlers := map[string]Throttler{
+		"fixed window": window,
+	}
+	for name, constructor := range constructors {
+		throttlers[name] = constructor(&mockGetSetter{})
+	}
+	for name, throttler := range throttlers {
+		for _, threshold := range []time.Duration{0, -time.Second} {
+			t.Run(fmt.Sprintf("%s %v", name, threshold), func(t *testing.T) {
+				if result := <-throttler.LinearThrottle(threshold, "id"); result.Error != ErrInvalidThreshold {
+					t.Errorf("Expected %v, got %v", ErrInvalidThreshold, result.Error)
+				}
+				if result := <-throttler.ExponentialThrottle(threshold, "id"); result.Error != ErrInvalidThreshold {
+					t.Errorf("Expected %v, got %v", ErrInvalidThreshold, result.Error)
+				}
+			})
+		}
+	}
+
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{})
+	if _, _, err := limiter.LinearAllowN(0, "id", 2); err != ErrInvalidThreshold {
+		t.Errorf("Expected %v, got %v", ErrInvalidThreshold, err)
+	}
+	if _, err := limiter.Reserve(-time.Second, "id"); err != ErrInvalidThreshold {
+		t.Errorf("Expected %v, got %v", ErrInvalidThreshold, err)
+	}
+}
+
+func TestNegativeTimeout(t *testing.T) {
+	constructors := map[string]func() error{
+		"token bucket": func() error {
+			_, err := NewTokenBucket(1, -time.Second, &mockGetSetter{})
+			return err
+		},
+		"sliding window": func() error {
+			_, err := NewSlidingWindow(1, -time.Second, &mockGetSetter{})
+			return err
+		},
+		"leaky bucket": func() error {
+			_, err := NewLeakyBucket(1, -time.Second, &mockGetSetter{})
+			return err
+		},
+		"fixed window": func() error {
+			_, err := NewFixedWindow(1, -time.Second, &mockGetSetter{})
+			return err
+		},
+		"limiter": func() error {
+			_, err := NewLimiter(-time.Second, &mockGetSetter{})
+			return err
+		},
+	}
+	for name, constructor := range constructors {
+		t.Run(name, func(t *testing.T) {
+			if err := constructor(); err == nil {
+				t.Error("Expected error when passing negative timeout")
+			}
+		})
+	}
+}
+
+func TestNonPositiveLimit(t *testing.T) {
+	constructors := map[string]func(int) error{
+		"token bucket": func(n int) error {
+			_, err := NewTokenBucket(n, time.Second, &mockGetSetter{})
+			return err
+		},
+		"sliding window": func(n int) error {
+			_, err := NewSlidingWindow(n, time.Second, &mockGetSetter{})
+			return err
+		},
+		"leaky bucket": func(n int) error {
+			_, err := NewLeakyBucket(n, time.Second, &mockGetSetter{})
+			return err
+		},
+		"fixed window": func(n int) error {
+			_, err := NewFixedWindow(n, time.Second, &mockGetSetter{})
+			return err
+		},
+	}
+	for name, constructor := range constructors {
+		for _, limit := range []int{0, -1} {
+			t.Run(fmt.Sprintf("%s %d", name, limit), func(t *testing.T) {
+				if err := constructor(limit); err == nil {
+					t.Errorf("Expected error when passing limit of %d", limit)
+				}
+			})
+		}
+	}
+}
+
+func TestLimiter_LinearAllow_VaryingThresholds(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithClock(clock))
+
+	expected := []struct {
+		threshold time.Duration
+		delay     time.Duration
+	}{
+		{time.Minute, 0},
+		{time.Millisecond, time.Minute},
+		{time.Minute, time.Minute + time.Millisecond},
+		{time.Second, time.Minute*2 + time.Millisecond},
+	}
+	for _, e := range expected {
+		if _, delay, _ := limiter.LinearAllow(e.threshold, "varying"); delay != e.delay {
+			t.Errorf("Expected delay of %v, got %v", e.delay, delay)
+		}
+	}
+}
+
+func TestLimiter_LinearThrottleWithTimeout(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxWait       time.Duration
+		expectedError error
+	}{
+		{"within per-call timeout", time.Millisecond * 100, nil},
+		{"exceeds per-call timeout", time.Millisecond, ErrWouldExceedDeadline},
+		{"default timeout", 0, ErrWouldExceedDeadline},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter, _ := NewLimiter(time.Millisecond*10, &mockGetSetter{})
+
+			<-limiter.LinearThrottleWithTimeout(time.Millisecond*50, "timeout", test.maxWait)
+			result := <-limiter.LinearThrottleWithTimeout(time.Millisecond*50, "timeout", test.maxWait)
+			if !errors.Is(result.Error, test.expectedError) {
+				t.Errorf("Expected %v, got %v", test.expectedError, result.Error)
+			}
+		})
+	}
+}
+
+func TestLimiter_LinearAllowN(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithClock(clock))
+
+	tests := []struct {
+		n             int
+		expectedOK    bool
+		expectedDelay time.Duration
+		expectedError error
+	}{
+		{3, true, 0, nil},
+		{2, false, time.Minute * 20, nil},
+		{1, true, time.Hour, nil},
+		{0, false, 0, ErrInvalidCost},
+	}
+	for _, test := range tests {
+		ok, delay, err := limiter.LinearAllowN(time.Minute*20, "allow-n", test.n)
+		if ok != test.expectedOK {
+			t.Errorf("Expected %v, got %v", test.expectedOK, ok)
+		}
+		if delay != test.expectedDelay {
+			t.Errorf("Expected %v, got %v", test.expectedDelay, delay)
+		}
+		if err != test.expectedError {
+			t.Errorf("Expected %v, got %v", test.expectedError, err)
+		}
+	}
+}
+
+func TestLimiter_LinearThrottleCost(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithClock(clock))
+
+	if result := <-limiter.LinearThrottleCost(time.Second, "cost", -1); result.Error != ErrInvalidCost {
+		t.Errorf("Expected %v, got %v", ErrInvalidCost, result.Error)
+	}
+	if result := <-limiter.LinearThrottleCost(time.Second, "cost", 3); result.Error != nil || result.Delay != 0 {
+		t.Errorf("Unexpected result %v", result)
+	}
+	if remaining, _ := limiter.Peek("cost"); remaining != time.Second*3 {
+		t.Errorf("Expected remaining delay of 3s, got %v", remaining)
+	}
+	if _, _, err := limiter.LinearAllowCost(time.Second, "cost", 0); err != ErrInvalidCost {
+		t.Errorf("Expected %v, got %v", ErrInvalidCost, err)
+	}
+	if ok, delay, err := limiter.LinearAllowCost(time.Second, "cost", 2); ok || delay != time.Second*3 || err != nil {
+		t.Errorf("Unexpected result %v, %v, %v", ok, delay, err)
+	}
+	if remaining, _ := limiter.Peek("cost"); remaining != time.Second*5 {
+		t.Errorf("Expected remaining delay of 5s, got %v", remaining)
+	}
+}
+
+func TestLimiter_RetryAt(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := ratelimitertest.NewFakeClock(start)
+	limiter, _ := NewLimiter(time.Second, &mockGetSetter{}, WithClock(clock))
+
+	if result := <-limiter.LinearThrottle(time.Minute, "retry"); !result.RetryAt.IsZero() {
+		t.Errorf("Expected zero RetryAt, got %v", result.RetryAt)
+	}
+	result := <-limiter.LinearThrottle(time.Minute, "retry")
+	if !errors.Is(result.Error, ErrWouldExceedDeadline) {
+		t.Errorf("Expected %v, got %v", ErrWouldExceedDeadline, result.Error)
+	}
+	if !result.RetryAt.Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected RetryAt of %v, got %v", start.Add(time.Minute), result.RetryAt)
+	}
+}
+
+func TestDeadlineExceededError(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter, _ := NewLimiter(time.Second, &mockGetSetter{}, WithClock(clock))
+
+	<-limiter.LinearThrottle(time.Minute, "deadline")
+	result := <-limiter.LinearThrottle(time.Minute, "deadline")
+	var deadlineErr *DeadlineExceededError
+	if !errors.As(result.Error, &deadlineErr) {
+		t.Fatalf("Expected DeadlineExceededError, got %v", result.Error)
+	}
+	expected := DeadlineExceededError{Key: limiter.Key("deadline"), Remaining: time.Minute, Deadline: time.Second}
+	if *deadlineErr != expected {
+		t.Errorf("Expected %v, got %v", expected, *deadlineErr)
+	}
+}
+
+func TestLimiter_Peek(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithClock(clock))
+
+	if remaining, limited := limiter.Peek("peek"); remaining != 0 || limited {
+		t.Errorf("Expected no limit for unknown identifier, got %v, %v", remaining, limited)
+	}
+
+	<-limiter.LinearThrottle(time.Minute, "peek")
+	clock.Advance(time.Second * 10)
+
+	for i := 0; i < 2; i++ {
+		if remaining, limited := limiter.Peek("peek"); remaining != time.Second*50 || !limited {
+			t.Errorf("Expected remaining delay of 50s, got %v, %v", remaining, limited)
+		}
+	}
+}
+
+func TestLimiter_Reset(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		limiter, _ := NewLimiter(time.Hour, &mockGetSetter{})
+		<-limiter.LinearThrottle(time.Minute, "reset")
+		if err := limiter.Reset("reset"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if result := <-limiter.LinearThrottle(time.Minute, "reset"); result != (Result{}) {
+			t.Errorf("Expected empty result, got %v", result)
+		}
+	})
+	t.Run("rotated salt", func(t *testing.T) {
+		limiter, _ := NewLimiter(time.Hour, &mockGetSetter{})
+		<-limiter.LinearThrottle(time.Minute, "reset")
+		limiter.RotateSalt([]byte("next"), time.Hour)
+		if err := limiter.Reset("reset"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if _, limited := limiter.Peek("reset"); limited {
+			t.Error("Expected limit stored using previous salt to be removed")
+		}
+	})
+	t.Run("unsupported", func(t *testing.T) {
+		limiter, _ := NewLimiter(time.Hour, &struct{ GetSetter }{&mockGetSetter{}})
+		if err := limiter.Reset("reset"); err != errDeleteUnsupported {
+			t.Errorf("Expected %v, got %v", errDeleteUnsupported, err)
+		}
+	})
+}
+
+func TestLimiter_Key(t *testing.T) {
+	cache := &mockGetSetter{}
+	limiter, _ := NewLimiter(time.Hour, cache, WithSalt([]byte("salt")))
+	<-limiter.LinearThrottle(time.Minute, "key")
+
+	key := limiter.Key("key")
+	if key != sha256Hex([]byte("keysalt")) {
+		t.Errorf("Unexpected key %v", key)
+	}
+	if _, found := cache.Get(key); !found {
+		t.Errorf("Expected value to be stored at %v", key)
+	}
+
+	limiter.RotateSalt([]byte("other"), time.Hour)
+	rotated := limiter.Key("key")
+	if rotated == key {
+		t.Errorf("Expected key to change after rotation, got %v", rotated)
+	}
+	if _, found := cache.Get(rotated); found {
+		t.Errorf("Expected Key not to move value to %v", rotated)
+	}
+	if _, found := cache.Get(key); !found {
+		t.Errorf("Expected value to be kept at %v", key)
+	}
+}
+
 func ExampleNew() {
 	limiter := New(time.Hour, &mockGetSetter{})
 
@@ -98,3 +633,23 @@ func ExampleNew() {
 	// true
 	// false
 }
+
+func BenchmarkLimiter_LinearThrottle(b *testing.B) {
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if result := <-limiter.LinearThrottle(time.Nanosecond, "benchmark"); result.Error != nil {
+			b.Fatalf("Unexpected error %v", result.Error)
+		}
+	}
+}
+
+func BenchmarkLimiter_hash(b *testing.B) {
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		limiter.hash("benchmark")
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimitertest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/internal/value"
+)
+
+// Call describes a single operation performed on a RecordingCache.
+type Call struct {
+	Op  string
+	Key string
+}
+
+// RecordingCache implements ratelimiter.GetSetter, ratelimiter.Adder,
+// ratelimiter.CompareAndSwapper and ratelimiter.Deleter, recording all
+// operations in the order they have been performed so tests can assert
+// on the sequence of cache accesses. Values expire using the given clock,
+// which allows combining the cache with a FakeClock.
+type RecordingCache struct {
+	lock   sync.Mutex
+	clock  interface{ Now() time.Time }
+	values map[string]recordedValue
+	calls  []Call
+}
+
+type recordedValue struct {
+	value   interface{}
+	expires time.Time
+}
+
+func (r *RecordingCache) load(key string) (interface{}, bool) {
+	v, ok := r.values[key]
+	if !ok || !r.clock.Now().Before(v.expires) {
+		return nil, false
+	}
+	return v.value, true
+}
+
+func (r *RecordingCache) record(op, key string) {
+	r.calls = append(r.calls, Call{Op: op, Key: key})
+}
+
+// Get returns the value stored for the given key.
+func (r *RecordingCache) Get(key string) (interface{}, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.record("Get", key)
+	return r.load(key)
+}
+
+// Set stores the given value for the given duration.
+func (r *RecordingCache) Set(key string, value interface{}, expiry time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.record("Set", key)
+	r.values[key] = recordedValue{value, r.clock.Now().Add(expiry)}
+}
+
+// Add stores the given value for the given duration in case no value is
+// stored for the given key yet.
+func (r *RecordingCache) Add(key string, value interface{}, expiry time.Duration) (bool, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.record("Add", key)
+	if _, ok := r.load(key); ok {
+		return false, nil
+	}
+	r.values[key] = recordedValue{value, r.clock.Now().Add(expiry)}
+	return true, nil
+}
+
+// CompareAndSwap replaces the value stored for the given key in case it
+// equals the given old value.
+func (r *RecordingCache) CompareAndSwap(key string, old, new interface{}, expiry time.Duration) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.record("CompareAndSwap", key)
+	if v, ok := r.load(key); !ok || !value.Equal(v, old) {
+		return false
+	}
+	r.values[key] = recordedValue{new, r.clock.Now().Add(expiry)}
+	return true
+}
+
+// Delete removes the value stored for the given key.
+func (r *RecordingCache) Delete(key string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.record("Delete", key)
+	delete(r.values, key)
+}
+
+// Calls returns a copy of all operations recorded so far.
+func (r *RecordingCache) Calls() []Call {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]Call{}, r.calls...)
+}
+
+// NewRecordingCache returns an empty RecordingCache expiring values using
+// the given clock.
+func NewRecordingCache(clock interface{ Now() time.Time }) *RecordingCache {
+	return &RecordingCache{clock: clock, values: map[string]recordedValue{}}
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimitertest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordingCache(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := NewRecordingCache(clock)
+
+	cache.Set("key", "value", time.Minute)
+	if !cache.CompareAndSwap("key", "value", "next", time.Minute) {
+		t.Error("Expected swap of matching value")
+	}
+	clock.Advance(time.Minute)
+	if _, found := cache.Get("key"); found {
+		t.Error("Expected value to be expired")
+	}
+	cache.Delete("key")
+
+	cache.Set("bytes", []byte("value"), time.Minute)
+	if cache.CompareAndSwap("bytes", "value", "next", time.Minute) {
+		t.Error("Expected no swap of value of different type")
+	}
+	if !cache.CompareAndSwap("bytes", []byte("value"), "next", time.Minute) {
+		t.Error("Expected swap of matching byte slice")
+	}
+
+	expected := []Call{
+		{"Set", "key"},
+		{"CompareAndSwap", "key"},
+		{"Get", "key"},
+		{"Delete", "key"},
+		{"Set", "bytes"},
+		{"CompareAndSwap", "bytes"},
+		{"CompareAndSwap", "bytes"},
+	}
+	if calls := cache.Calls(); !reflect.DeepEqual(expected, calls) {
+		t.Errorf("Expected %v, got %v", expected, calls)
+	}
+}
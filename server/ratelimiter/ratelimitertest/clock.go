@@ -0,0 +1,93 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package ratelimitertest provides utilities for testing code that
+// uses package ratelimiter.
+package ratelimitertest
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock implements ratelimiter.Clock. Time only passes when calling
+// `Advance` so tests can be driven deterministically.
+type FakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	until time.Time
+	c     chan time.Time
+}
+
+// Now returns the clock's current time.
+func (f *FakeClock) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+// After returns a channel that receives the clock's current time once the
+// clock has been advanced by at least the given duration.
+func (f *FakeClock) After(d time.Duration) <-chan time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	c := make(chan time.Time, 1)
+	if d <= 0 {
+		c <- f.now
+		return c
+	}
+	f.waiters = append(f.waiters, waiter{until: f.now.Add(d), c: c})
+	return c
+}
+
+// NewTimer works like After, but also returns a function for stopping the
+// timer, which removes it from the clock's waiters. Stopping reports
+// whether the timer has been stopped before firing.
+func (f *FakeClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	c := f.After(d)
+	return c, func() bool {
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		for i, w := range f.waiters {
+			if w.c == c {
+				f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Advance moves the clock forward by the given duration, notifying all
+// waiters whose duration has passed.
+func (f *FakeClock) Advance(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.now = f.now.Add(d)
+	var pending []waiter
+	for _, w := range f.waiters {
+		if w.until.After(f.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.c <- f.now
+	}
+	f.waiters = pending
+}
+
+// Waiters returns the number of callers currently waiting for the clock
+// to advance.
+func (f *FakeClock) Waiters() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.waiters)
+}
+
+// NewFakeClock returns a FakeClock that is set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimitertest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	immediate := clock.After(0)
+	select {
+	case <-immediate:
+	default:
+		t.Error("Expected zero duration to fire immediately")
+	}
+
+	c := clock.After(time.Minute)
+	clock.Advance(time.Second * 30)
+	select {
+	case <-c:
+		t.Error("Unexpected firing before duration has passed")
+	default:
+	}
+	if clock.Waiters() != 1 {
+		t.Errorf("Expected 1 waiter, got %d", clock.Waiters())
+	}
+
+	clock.Advance(time.Second * 30)
+	select {
+	case now := <-c:
+		if !now.Equal(start.Add(time.Minute)) {
+			t.Errorf("Unexpected time %v", now)
+		}
+	default:
+		t.Error("Expected firing after duration has passed")
+	}
+	if clock.Waiters() != 0 {
+		t.Errorf("Expected no waiters, got %d", clock.Waiters())
+	}
+}
+
+func TestFakeClock_NewTimer(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	c, stop := clock.NewTimer(time.Minute)
+	if !stop() {
+		t.Error("Expected pending timer to be stopped")
+	}
+	if clock.Waiters() != 0 {
+		t.Errorf("Expected no waiters, got %d", clock.Waiters())
+	}
+	clock.Advance(time.Minute)
+	select {
+	case <-c:
+		t.Error("Unexpected firing of stopped timer")
+	default:
+	}
+
+	c, stop = clock.NewTimer(time.Minute)
+	clock.Advance(time.Minute)
+	<-c
+	if stop() {
+		t.Error("Expected fired timer not to be stopped")
+	}
+}
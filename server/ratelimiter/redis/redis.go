@@ -0,0 +1,159 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package redis provides a ratelimiter.GetSetter that stores limits in Redis,
+// allowing multiple instances to share limits. Instances sharing a cache
+// need to use the same salt (see ratelimiter.WithSalt).
+package redis
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+var errUnsupportedValue = errors.New("redis: value does not implement encoding.BinaryMarshaler")
+
+// compareAndSwapScript only sets the given value in case the currently
+// stored value equals the expected one.
+var compareAndSwapScript = redigo.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+end
+return false
+`)
+
+// Cache implements ratelimiter.GetSetter, ratelimiter.GetErrer,
+// ratelimiter.SetErrer, ratelimiter.Adder, ratelimiter.CompareAndSwapper,
+// ratelimiter.Deleter and ratelimiter.Pinger using Redis. Values are
+// serialized using their encoding.BinaryMarshaler implementation and
+// returned as []byte when read.
+type Cache struct {
+	pool *redigo.Pool
+}
+
+// Get returns the value stored for the given key. Errors talking to Redis
+// are treated like missing values, use GetErr for handling them.
+func (c *Cache) Get(key string) (interface{}, bool) {
+	value, found, _ := c.GetErr(key)
+	return value, found
+}
+
+// GetErr returns the value stored for the given key, returning an error in
+// case Redis cannot be reached.
+func (c *Cache) GetErr(key string) (interface{}, bool, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+	value, err := redigo.Bytes(conn.Do("GET", key))
+	if err == redigo.ErrNil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("redis: error getting value: %w", err)
+	}
+	return value, true, nil
+}
+
+// Set stores the given value using the given expiry. Errors are skipped,
+// use SetErr for handling them.
+func (c *Cache) Set(key string, value interface{}, expiry time.Duration) {
+	c.SetErr(key, value, expiry)
+}
+
+// SetErr stores the given value using the given expiry, returning an error
+// in case the value cannot be serialized or stored.
+func (c *Cache) SetErr(key string, value interface{}, expiry time.Duration) error {
+	data, err := marshal(value)
+	if err != nil {
+		return err
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("SET", key, data, "PX", milliseconds(expiry)); err != nil {
+		return fmt.Errorf("redis: error setting value: %w", err)
+	}
+	return nil
+}
+
+// Add stores the given value using the given expiry in case no value is
+// stored for the given key yet.
+func (c *Cache) Add(key string, value interface{}, expiry time.Duration) (bool, error) {
+	data, err := marshal(value)
+	if err != nil {
+		return false, err
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+	reply, err := conn.Do("SET", key, data, "PX", milliseconds(expiry), "NX")
+	if err != nil {
+		return false, fmt.Errorf("redis: error adding value: %w", err)
+	}
+	return reply != nil, nil
+}
+
+// CompareAndSwap atomically replaces the value stored for the given key in
+// case it still equals the given old value.
+func (c *Cache) CompareAndSwap(key string, old, new interface{}, expiry time.Duration) bool {
+	oldData, err := marshal(old)
+	if err != nil {
+		return false
+	}
+	newData, err := marshal(new)
+	if err != nil {
+		return false
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+	reply, err := compareAndSwapScript.Do(conn, key, oldData, newData, milliseconds(expiry))
+	return err == nil && reply != nil
+}
+
+// Delete removes the value stored for the given key. Errors are skipped as
+// missing values are treated the same as deleted ones.
+func (c *Cache) Delete(key string) {
+	conn := c.pool.Get()
+	defer conn.Close()
+	conn.Do("DEL", key)
+}
+
+// Ping checks whether Redis is reachable.
+func (c *Cache) Ping(ctx context.Context) error {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("redis: error getting connection: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err != nil {
+		return fmt.Errorf("redis: error pinging: %w", err)
+	}
+	return nil
+}
+
+func marshal(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case encoding.BinaryMarshaler:
+		return v.MarshalBinary()
+	default:
+		return nil, errUnsupportedValue
+	}
+}
+
+// milliseconds converts the given expiry into a value that is accepted
+// by Redis' PX argument, which requires a positive integer.
+func milliseconds(expiry time.Duration) int64 {
+	if ms := expiry.Milliseconds(); ms > 0 {
+		return ms
+	}
+	return 1
+}
+
+// New creates a new Cache using the given connection pool.
+func New(pool *redigo.Pool) *Cache {
+	return &Cache{pool: pool}
+}
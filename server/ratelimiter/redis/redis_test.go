@@ -0,0 +1,124 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build redis
+// +build redis
+
+package redis
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+func newTestCache(t *testing.T) *Cache {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	pool := &redigo.Pool{
+		Dial: func() (redigo.Conn, error) {
+			return redigo.Dial("tcp", addr)
+		},
+	}
+	t.Cleanup(func() {
+		pool.Close()
+	})
+	conn := pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("FLUSHDB"); err != nil {
+		t.Fatalf("Error connecting to Redis at %s: %v", addr, err)
+	}
+	return New(pool)
+}
+
+type binaryValue string
+
+func (b binaryValue) MarshalBinary() ([]byte, error) {
+	return []byte(b), nil
+}
+
+func TestCache(t *testing.T) {
+	cache := newTestCache(t)
+
+	if _, found := cache.Get("key"); found {
+		t.Error("Unexpected value for unknown key")
+	}
+
+	cache.Set("key", binaryValue("value"), time.Millisecond*100)
+	if value, found := cache.Get("key"); !found || string(value.([]byte)) != "value" {
+		t.Errorf("Unexpected value %v", value)
+	}
+
+	if cache.CompareAndSwap("key", binaryValue("other"), binaryValue("next"), time.Second) {
+		t.Error("Unexpected swap of non-matching value")
+	}
+	if !cache.CompareAndSwap("key", []byte("value"), binaryValue("next"), time.Millisecond*100) {
+		t.Error("Expected swap of matching value")
+	}
+	if value, _ := cache.Get("key"); string(value.([]byte)) != "next" {
+		t.Errorf("Unexpected value %v", value)
+	}
+
+	time.Sleep(time.Millisecond * 150)
+	if _, found := cache.Get("key"); found {
+		t.Error("Expected value to expire")
+	}
+}
+
+func TestCache_Delete(t *testing.T) {
+	cache := newTestCache(t)
+	cache.Set("key", binaryValue("value"), time.Minute)
+	cache.Delete("key")
+	if _, found := cache.Get("key"); found {
+		t.Error("Expected value to be deleted")
+	}
+	cache.Delete("unknown")
+
+	limiter, _ := ratelimiter.NewLimiter(time.Hour, cache)
+	<-limiter.LinearThrottle(time.Minute, "reset")
+	if err := limiter.Reset("reset"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, limited := limiter.Peek("reset"); limited {
+		t.Error("Expected limit to be reset")
+	}
+}
+
+func TestCache_Limiter(t *testing.T) {
+	cache := newTestCache(t)
+	salt := ratelimiter.WithSalt([]byte("salt"))
+	a, _ := ratelimiter.NewLimiter(time.Hour, cache, salt)
+	b, _ := ratelimiter.NewLimiter(time.Hour, cache, salt)
+
+	if result := <-a.LinearThrottle(time.Millisecond*100, "shared"); result.Error != nil || result.Delay != 0 {
+		t.Errorf("Unexpected result %v", result)
+	}
+	if result := <-b.LinearThrottle(time.Millisecond*100, "shared"); result.Error != nil || result.Delay == 0 {
+		t.Errorf("Expected limit to be shared across limiters, got %v", result)
+	}
+}
+
+func TestCache_Ping(t *testing.T) {
+	cache := newTestCache(t)
+	if err := cache.Ping(context.Background()); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	unreachable := New(&redigo.Pool{
+		Dial: func() (redigo.Conn, error) {
+			return redigo.Dial("tcp", "localhost:0")
+		},
+	})
+	if err := unreachable.Ping(context.Background()); err == nil {
+		t.Error("Expected error pinging unreachable Redis")
+	}
+	if _, _, err := unreachable.GetErr("key"); err == nil {
+		t.Error("Expected error reading from unreachable Redis")
+	}
+}
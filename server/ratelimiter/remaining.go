@@ -0,0 +1,83 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"time"
+)
+
+// Remainer is implemented by throttlers that count calls, reporting the
+// number of calls that can currently be made for an identifier without
+// being delayed and the time until all of its quota is available again.
+// It does not update any stored limit. As thresholds are passed per call,
+// the threshold in use needs to be passed. Throttlers are not required to
+// implement it, so callers should use a type assertion.
+type Remainer interface {
+	Remaining(threshold time.Duration, identifier string) (int, time.Duration)
+}
+
+// Remaining returns the number of tokens left in the bucket for the given
+// identifier and the time until the bucket has been refilled.
+func (t *TokenBucket) Remaining(threshold time.Duration, identifier string) (int, time.Duration) {
+	value, found := t.cache.Get(t.hash(identifier))
+	if !found || threshold <= 0 {
+		return t.capacity, 0
+	}
+	item, ok := decodeBucketItem(value)
+	if !ok {
+		return t.capacity, 0
+	}
+	tokens := item.tokens + float64(elapsed(t.clock.Now(), item.lastRefill))/float64(threshold)
+	if tokens >= float64(t.capacity) {
+		return t.capacity, 0
+	}
+	reset := time.Duration((float64(t.capacity) - tokens) * float64(threshold))
+	if tokens < 0 {
+		return 0, reset
+	}
+	return int(tokens), reset
+}
+
+// Remaining returns the number of calls left within the current window for
+// the given identifier and the time until all calls have left the window.
+func (s *SlidingWindow) Remaining(threshold time.Duration, identifier string) (int, time.Duration) {
+	value, found := s.cache.Get(s.hash(identifier))
+	if !found {
+		return s.limit, 0
+	}
+	item, ok := decodeWindowItem(value)
+	if !ok {
+		return s.limit, 0
+	}
+	now := s.clock.Now()
+	calls := prune(item.calls, now.Add(-threshold), s.limit)
+	if len(calls) == 0 {
+		return s.limit, 0
+	}
+	return s.limit - len(calls), calls[len(calls)-1].Add(threshold).Sub(now)
+}
+
+// Remaining returns the number of calls left within the current window for
+// the given identifier and the time until the window ends. Calls that have
+// been delayed into later windows are not taken into account.
+func (f *FixedWindow) Remaining(threshold time.Duration, identifier string) (int, time.Duration) {
+	if threshold <= 0 {
+		return f.limit, 0
+	}
+	now := f.clock.Now()
+	start := windowStart(now, threshold)
+	value, found := f.cache.Get(f.windowKey(f.hash(identifier), start, threshold))
+	if !found {
+		return f.limit, 0
+	}
+	item, ok := decodeCounterItem(value)
+	if !ok || item.count == 0 {
+		return f.limit, 0
+	}
+	remaining := f.limit - item.count
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, start.Add(threshold).Sub(now)
+}
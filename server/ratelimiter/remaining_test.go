@@ -0,0 +1,50 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestRemainer(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 30, 0, time.UTC))
+	bucket, _ := NewTokenBucket(3, time.Hour, &mockGetSetter{}, WithClock(clock))
+	sliding, _ := NewSlidingWindow(3, time.Hour, &mockGetSetter{}, WithClock(clock))
+	fixed, _ := NewFixedWindow(3, time.Hour, &mockGetSetter{}, WithClock(clock))
+
+	tests := []struct {
+		name              string
+		throttler         Throttler
+		calls             int
+		expectedRemaining int
+		expectedReset     time.Duration
+	}{
+		{"token bucket unused", bucket, 0, 3, 0},
+		{"token bucket", bucket, 2, 1, time.Minute * 2},
+		{"token bucket empty", bucket, 1, 0, time.Minute * 3},
+		{"sliding window unused", sliding, 0, 3, 0},
+		{"sliding window", sliding, 2, 1, time.Minute},
+		{"sliding window full", sliding, 1, 0, time.Minute},
+		{"fixed window unused", fixed, 0, 3, 0},
+		{"fixed window", fixed, 2, 1, time.Second * 30},
+		{"fixed window full", fixed, 1, 0, time.Second * 30},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := 0; i < test.calls; i++ {
+				<-test.throttler.LinearThrottle(time.Minute, "remaining")
+			}
+			remaining, reset := test.throttler.(Remainer).Remaining(time.Minute, "remaining")
+			if remaining != test.expectedRemaining {
+				t.Errorf("Expected %v, got %v", test.expectedRemaining, remaining)
+			}
+			if reset != test.expectedReset {
+				t.Errorf("Expected reset of %v, got %v", test.expectedReset, reset)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package remote provides a ratelimiter.Throttler that delegates decisions
+// to an external HTTP service, so local and centralized enforcement can be
+// used through the same interface.
+//
+// For each call, the service receives a POST request carrying a JSON body
+// like {"identifier": "...", "threshold": 1000000000, "exponential": false},
+// where threshold is given in nanoseconds. Responses with a status of 2xx
+// allow the call, responses with a status of 429 reject it using
+// ratelimiter.ErrWouldExceedDeadline, passing the Retry-After header as the
+// delay to wait before retrying. All other responses are treated as errors.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+// Throttler is a ratelimiter.Throttler asking a remote service for each
+// decision.
+type Throttler struct {
+	endpoint      string
+	client        *http.Client
+	timeout       time.Duration
+	failurePolicy ratelimiter.FailurePolicy
+}
+
+// Option is used to configure a Throttler.
+type Option func(*Throttler)
+
+// WithClient makes the Throttler send requests using the given client
+// instead of http.DefaultClient.
+func WithClient(c *http.Client) Option {
+	return func(t *Throttler) {
+		t.client = c
+	}
+}
+
+// WithTimeout sets the maximum time to wait for a decision of the remote
+// service. It defaults to one second.
+func WithTimeout(d time.Duration) Option {
+	return func(t *Throttler) {
+		t.timeout = d
+	}
+}
+
+// WithFailurePolicy defines how the Throttler behaves when the remote
+// service cannot be reached or responds with an unexpected status.
+// It defaults to ratelimiter.FailClosed.
+func WithFailurePolicy(p ratelimiter.FailurePolicy) Option {
+	return func(t *Throttler) {
+		t.failurePolicy = p
+	}
+}
+
+// New creates a new Throttler sending requests to the given endpoint.
+func New(endpoint string, opts ...Option) *Throttler {
+	t := &Throttler{
+		endpoint: endpoint,
+		client:   http.DefaultClient,
+		timeout:  time.Second,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+type decisionRequest struct {
+	Identifier  string        `json:"identifier"`
+	Threshold   time.Duration `json:"threshold"`
+	Exponential bool          `json:"exponential"`
+}
+
+// LinearThrottle asks the remote service for a linear throttling decision.
+func (t *Throttler) LinearThrottle(threshold time.Duration, identifier string) <-chan ratelimiter.Result {
+	return t.LinearThrottleCtx(context.Background(), threshold, identifier)
+}
+
+// ExponentialThrottle asks the remote service for an exponential throttling
+// decision.
+func (t *Throttler) ExponentialThrottle(threshold time.Duration, identifier string) <-chan ratelimiter.Result {
+	return t.ExponentialThrottleCtx(context.Background(), threshold, identifier)
+}
+
+// LinearThrottleCtx works like LinearThrottle, but stops waiting for the
+// remote service as soon as the given context is cancelled.
+func (t *Throttler) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan ratelimiter.Result {
+	return t.throttle(ctx, decisionRequest{Identifier: identifier, Threshold: threshold})
+}
+
+// ExponentialThrottleCtx works like ExponentialThrottle, but stops waiting
+// for the remote service as soon as the given context is cancelled.
+func (t *Throttler) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan ratelimiter.Result {
+	return t.throttle(ctx, decisionRequest{Identifier: identifier, Threshold: threshold, Exponential: true})
+}
+
+func (t *Throttler) throttle(ctx context.Context, req decisionRequest) <-chan ratelimiter.Result {
+	out := make(chan ratelimiter.Result, 1)
+	go func() {
+		defer close(out)
+		result, err := t.decide(ctx, req)
+		if err != nil && t.failurePolicy == ratelimiter.FailClosed {
+			result = ratelimiter.Result{Error: err}
+		}
+		out <- result
+	}()
+	return out
+}
+
+func (t *Throttler) decide(ctx context.Context, req decisionRequest) (ratelimiter.Result, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return ratelimiter.Result{}, fmt.Errorf("remote: error encoding request: %w", err)
+	}
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return ratelimiter.Result{}, fmt.Errorf("remote: error creating request: %w", err)
+	}
+	r.Header.Set("Content-Type", "application/json")
+	res, err := t.client.Do(r)
+	if err != nil {
+		return ratelimiter.Result{}, fmt.Errorf("remote: error requesting decision: %w", err)
+	}
+	defer res.Body.Close()
+	// draining the body allows the connection to be reused
+	io.Copy(ioutil.Discard, res.Body)
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return ratelimiter.Result{}, nil
+	case res.StatusCode == http.StatusTooManyRequests:
+		delay := retryAfter(res.Header.Get("Retry-After"), time.Now())
+		return ratelimiter.Result{Error: ratelimiter.ErrWouldExceedDeadline, Delay: delay}, nil
+	default:
+		return ratelimiter.Result{}, fmt.Errorf("remote: unexpected response status %d", res.StatusCode)
+	}
+}
+
+// retryAfter parses the given Retry-After header value, which is either a
+// number of seconds or an HTTP date.
+func retryAfter(value string, now time.Time) time.Duration {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+func TestThrottler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req decisionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch req.Identifier {
+		case "allowed":
+			w.WriteHeader(http.StatusNoContent)
+		case "limited":
+			if req.Threshold != time.Minute || !req.Exponential {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "slow":
+			time.Sleep(100 * time.Millisecond)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		throttler     ratelimiter.Throttler
+		identifier    string
+		expectedDelay time.Duration
+		expectedError bool
+		expectedIs    error
+	}{
+		{"allowed", New(server.URL), "allowed", 0, false, nil},
+		{"limited", New(server.URL), "limited", 30 * time.Second, true, ratelimiter.ErrWouldExceedDeadline},
+		{"server error", New(server.URL), "other", 0, true, nil},
+		{"server error fail open", New(server.URL, WithFailurePolicy(ratelimiter.FailOpen)), "other", 0, false, nil},
+		{"timeout", New(server.URL, WithTimeout(10*time.Millisecond)), "slow", 0, true, nil},
+		{"unreachable", New("http://127.0.0.1:0"), "allowed", 0, true, nil},
+		{"unreachable fail open", New("http://127.0.0.1:0", WithFailurePolicy(ratelimiter.FailOpen)), "allowed", 0, false, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := <-test.throttler.ExponentialThrottle(time.Minute, test.identifier)
+			if (result.Error != nil) != test.expectedError {
+				t.Errorf("Unexpected error value %v", result.Error)
+			}
+			if test.expectedIs != nil && !errors.Is(result.Error, test.expectedIs) {
+				t.Errorf("Expected %v, got %v", test.expectedIs, result.Error)
+			}
+			if result.Delay != test.expectedDelay {
+				t.Errorf("Expected %v, got %v", test.expectedDelay, result.Delay)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"12", 12 * time.Second},
+		{"-1", 0},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"zomfg", 0},
+	}
+	for _, test := range tests {
+		if result := retryAfter(test.value, now); result != test.expected {
+			t.Errorf("Expected %v for %q, got %v", test.expected, test.value, result)
+		}
+	}
+}
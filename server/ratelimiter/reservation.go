@@ -0,0 +1,111 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Reservation is a slot that has been reserved using Limiter.Reserve. It
+// needs to be either committed or cancelled once the caller knows whether
+// the slot has been used. Reservations that are neither committed nor
+// cancelled behave as if they had been committed once the reserved slot
+// has passed.
+type Reservation struct {
+	// Delay is the time the caller needs to wait for before using the
+	// reserved slot.
+	Delay     time.Duration
+	limiter   *Limiter
+	key       string
+	threshold time.Duration
+	until     time.Time
+	once      sync.Once
+}
+
+// Reserve reserves the next slot for the given identifier just like
+// LinearAllow does, but returns a Reservation that allows returning the
+// slot in case it has not been used, e.g. because the work it has been
+// reserved for failed. Calls that would exceed the timeout return
+// ErrWouldExceedDeadline and do not reserve anything.
+func (l *Limiter) Reserve(threshold time.Duration, identifier string) (*Reservation, error) {
+	key := l.key(identifier)
+	delay, err := l.check(key, l.guard(l.cache, key, func() (time.Duration, error) {
+		return l.allow(threshold, key, false, 0)
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return &Reservation{
+		Delay:     delay,
+		limiter:   l,
+		key:       key,
+		threshold: threshold,
+		until:     l.clock.Now().Add(delay + threshold),
+	}, nil
+}
+
+// Commit finalizes the reservation. Calling Cancel afterwards has no
+// effect.
+func (r *Reservation) Commit() {
+	r.once.Do(func() {})
+}
+
+// Cancel returns the reserved slot by moving the stored limit back by one
+// threshold. Calling Cancel more than once, after Commit or after the
+// reserved slot has passed has no effect.
+func (r *Reservation) Cancel() error {
+	var err error
+	r.once.Do(func() {
+		err = r.limiter.release(r.key, r.threshold, r.until)
+	})
+	return err
+}
+
+// release moves the limit stored at the given key back by the given
+// threshold in case the slot ending at until has not passed yet.
+func (l *Limiter) release(key string, threshold time.Duration, until time.Time) error {
+	for {
+		now := l.clock.Now()
+		if !now.Before(until) {
+			return nil
+		}
+		value, found := l.cache.Get(key)
+		if !found {
+			return nil
+		}
+		if _, ok := l.blocked(value); ok {
+			return nil
+		}
+		item, ok := decodeCacheItem(value)
+		if !ok {
+			return nil
+		}
+		next := item.rebase(now)
+		next.blockUntil = next.blockUntil.Add(-threshold)
+		if next.blockUntil.Before(now) {
+			next.blockUntil = now
+		}
+		if next.queueLen > 1 {
+			next.queueLen--
+		}
+		next.updatedAt = now
+		// caches might treat non-positive expiries as never expiring
+		expiry := next.blockUntil.Sub(now)
+		if expiry <= 0 {
+			expiry = time.Millisecond
+		}
+		ok, err := update(l.cache, key, value, next, next.retain(expiry))
+		if err != nil {
+			_, err := l.handleCacheError(err)
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestLimiter_Reserve(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithClock(clock))
+
+	first, err := limiter.Reserve(time.Minute, "reserve")
+	if err != nil || first.Delay != 0 {
+		t.Fatalf("Unexpected result %v, %v", first, err)
+	}
+	first.Commit()
+	if err := first.Cancel(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	second, _ := limiter.Reserve(time.Minute, "reserve")
+	if second.Delay != time.Minute {
+		t.Errorf("Expected delay of %v, got %v", time.Minute, second.Delay)
+	}
+	if err := second.Cancel(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	second.Cancel()
+
+	if delay, _ := limiter.Peek("reserve"); delay != time.Minute {
+		t.Errorf("Expected cancelled slot to be returned, got remaining delay of %v", delay)
+	}
+
+	third, _ := limiter.Reserve(time.Minute, "reserve")
+	if third.Delay != time.Minute {
+		t.Errorf("Expected delay of %v, got %v", time.Minute, third.Delay)
+	}
+	clock.Advance(time.Minute * 3)
+	third.Cancel()
+	if _, ok := limiter.Peek("reserve"); ok {
+		t.Error("Expected cancelling a passed reservation to have no effect")
+	}
+
+	limiter, _ = NewLimiter(time.Millisecond, &mockGetSetter{})
+	limiter.Reserve(time.Minute, "deadline")
+	if _, err := limiter.Reserve(time.Minute, "deadline"); !errors.Is(err, ErrWouldExceedDeadline) {
+		t.Errorf("Expected %v, got %v", ErrWouldExceedDeadline, err)
+	}
+}
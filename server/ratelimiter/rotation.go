@@ -0,0 +1,100 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"time"
+)
+
+// RotateSalt replaces the salt used for hashing identifiers. As changing
+// the salt changes all keys, limits stored using the previous salt would be
+// lost. To prevent this, the previous salt is kept for the given grace
+// period, during which limits stored using the previous key are moved to
+// the new key when the identifier is used. After the grace period has
+// passed, limits stored using the previous salt are ignored. The grace
+// period should therefore be at least as long as the longest limit
+// in use.
+func (l *Limiter) RotateSalt(salt []byte, gracePeriod time.Duration) {
+	l.saltLock.Lock()
+	defer l.saltLock.Unlock()
+	l.previousSalt = l.salt
+	l.previousSaltUntil = l.clock.Now().Add(gracePeriod)
+	l.salt = append([]byte{}, salt...)
+}
+
+func (l *Limiter) hash(identifier string) string {
+	l.saltLock.RLock()
+	defer l.saltLock.RUnlock()
+	return l.options.hash(identifier)
+}
+
+// previousHash returns the key derived from the previous salt in case the
+// grace period of the last rotation has not passed yet.
+func (l *Limiter) previousHash(identifier string) (string, bool) {
+	l.saltLock.RLock()
+	defer l.saltLock.RUnlock()
+	if l.previousSalt == nil || !l.clock.Now().Before(l.previousSaltUntil) {
+		return "", false
+	}
+	return l.hashWithSalt(identifier, l.previousSalt), true
+}
+
+// lookup reads the value stored for the given identifier without moving
+// it, falling back to the key derived from the previous salt while the
+// grace period of the last rotation has not passed yet. It returns the key
+// the value has been found at, or the current key in case none is stored.
+func (l *Limiter) lookup(identifier string) (string, interface{}, bool) {
+	key := l.hash(identifier)
+	if value, found := l.cache.Get(key); found {
+		return key, value, true
+	}
+	if previous, ok := l.previousHash(identifier); ok {
+		if value, found := l.cache.Get(previous); found {
+			return previous, value, true
+		}
+	}
+	return key, nil, false
+}
+
+// key returns the key the limit for the given identifier is stored at. In
+// case the limit has been stored using a previous salt that is still in its
+// grace period, the limit is moved to the current key.
+func (l *Limiter) key(identifier string) string {
+	key := l.hash(identifier)
+	previous, ok := l.previousHash(identifier)
+	if !ok {
+		return key
+	}
+	if _, found := l.cache.Get(key); found {
+		return key
+	}
+	value, found := l.cache.Get(previous)
+	if !found {
+		return key
+	}
+	// values are migrated using the expiry they would be stored with
+	// when being updated
+	now := l.clock.Now()
+	var expiry time.Duration
+	if item, ok := decodeBlockItem(value); ok {
+		expiry = item.until.Sub(now)
+	} else if item, ok := decodeCacheItem(value); ok {
+		expiry = item.retain(item.blockUntil.Sub(now))
+	} else {
+		// values that cannot be migrated are left in place and expire
+		// on their own
+		return key
+	}
+	if expiry > 0 {
+		// in case a value has been stored at the current key in the
+		// meantime, it takes precedence
+		if ok, err := update(l.cache, key, nil, value, expiry); err != nil || !ok {
+			return key
+		}
+	}
+	if d, ok := l.cache.(Deleter); ok {
+		d.Delete(previous)
+	}
+	return key
+}
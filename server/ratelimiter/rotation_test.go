@@ -0,0 +1,128 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+// racingCache behaves as if another value was added concurrently whenever
+// a value is added once racing is set.
+type racingCache struct {
+	*ratelimitertest.RecordingCache
+	racing bool
+}
+
+func (r *racingCache) Add(key string, value interface{}, expiry time.Duration) (bool, error) {
+	if r.racing {
+		return false, nil
+	}
+	return r.RecordingCache.Add(key, value, expiry)
+}
+
+func TestLimiter_RotateSalt(t *testing.T) {
+	t.Run("within grace period", func(t *testing.T) {
+		clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithClock(clock))
+		limiter.LinearAllow(time.Minute, "rotate")
+		before := limiter.hash("rotate")
+
+		limiter.RotateSalt([]byte("next"), time.Minute)
+		if limiter.hash("rotate") == before {
+			t.Error("Expected key to change after rotating salt")
+		}
+		if remaining, limited := limiter.Peek("rotate"); !limited || remaining != time.Minute {
+			t.Errorf("Expected limit to be found using previous salt, got %v, %v", remaining, limited)
+		}
+		if ok, delay, _ := limiter.LinearAllow(time.Minute, "rotate"); ok || delay != time.Minute {
+			t.Errorf("Expected limit to be preserved, got %v, %v", ok, delay)
+		}
+	})
+	t.Run("peek", func(t *testing.T) {
+		clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		cache := ratelimitertest.NewRecordingCache(clock)
+		limiter, _ := NewLimiter(time.Hour, cache, WithClock(clock))
+		limiter.LinearAllow(time.Minute, "rotate")
+		limiter.RotateSalt([]byte("next"), time.Minute)
+
+		calls := len(cache.Calls())
+		if _, limited := limiter.Peek("rotate"); !limited {
+			t.Error("Expected limit to be found using previous salt")
+		}
+		for _, call := range cache.Calls()[calls:] {
+			if call.Op != "Get" {
+				t.Errorf("Unexpected call %v", call)
+			}
+		}
+	})
+	t.Run("blocked identifier", func(t *testing.T) {
+		clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithClock(clock))
+		limiter.Block("rotate", clock.Now().Add(time.Hour), "abuse")
+
+		limiter.RotateSalt([]byte("next"), time.Minute)
+		if _, _, err := limiter.LinearAllow(time.Minute, "rotate"); !errors.Is(err, ErrBlocked) {
+			t.Errorf("Expected %v, got %v", ErrBlocked, err)
+		}
+	})
+	t.Run("deadline", func(t *testing.T) {
+		clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		cache := ratelimitertest.NewRecordingCache(clock)
+		limiter, _ := NewLimiter(time.Second, cache, WithClock(clock))
+		limiter.SetDeadline("rotate", time.Hour)
+		clock.Advance(time.Minute)
+
+		limiter.RotateSalt([]byte("next"), time.Hour)
+		key := limiter.key("rotate")
+		value, found := cache.Get(key)
+		if !found {
+			t.Fatal("Expected passed limit carrying a deadline to be migrated")
+		}
+		if item, _ := decodeCacheItem(value); item.deadline != time.Hour {
+			t.Errorf("Expected %v, got %v", time.Hour, item.deadline)
+		}
+	})
+	t.Run("concurrent update", func(t *testing.T) {
+		clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		cache := &racingCache{RecordingCache: ratelimitertest.NewRecordingCache(clock)}
+		limiter, _ := NewLimiter(time.Hour, cache, WithClock(clock))
+		limiter.LinearAllow(time.Minute, "rotate")
+		previous := limiter.hash("rotate")
+
+		limiter.RotateSalt([]byte("next"), time.Hour)
+		cache.racing = true
+		limiter.key("rotate")
+		if _, found := cache.Get(previous); !found {
+			t.Error("Expected previous value to be kept when migration fails")
+		}
+	})
+	t.Run("unknown value", func(t *testing.T) {
+		clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		cache := &mockGetSetter{}
+		limiter, _ := NewLimiter(time.Hour, cache, WithClock(clock))
+		previous := limiter.hash("rotate")
+		cache.Set(previous, "zomfg", time.Hour)
+
+		limiter.RotateSalt([]byte("next"), time.Minute)
+		limiter.key("rotate")
+		if _, found := cache.Get(previous); !found {
+			t.Error("Expected value that cannot be migrated to be kept")
+		}
+	})
+	t.Run("after grace period", func(t *testing.T) {
+		clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		limiter, _ := NewLimiter(time.Hour, &mockGetSetter{}, WithClock(clock))
+		limiter.LinearAllow(time.Minute, "rotate")
+
+		limiter.RotateSalt([]byte("next"), time.Second)
+		clock.Advance(time.Second)
+		if ok, delay, _ := limiter.LinearAllow(time.Minute, "rotate"); !ok || delay != 0 {
+			t.Errorf("Expected limit to be dropped, got %v, %v", ok, delay)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+type sampled struct {
+	next Throttler
+	rate float64
+	rand io.Reader
+}
+
+// Sampled returns a Throttler that only passes a random fraction of calls
+// of about rate to next, while all other calls pass immediately using an
+// empty Result. Each call is sampled independently, so the wrapped
+// throttler only sees about rate times the actual number of calls and
+// limits need to be configured accordingly, e.g. by dividing thresholds by
+// rate. This trades accuracy for throughput and should only be used where
+// a probabilistic brake is sufficient. Random numbers are read from the
+// source next has been configured with using WithRandReader. In case no
+// random number can be read, calls are passed to next.
+func Sampled(next Throttler, rate float64) Throttler {
+	return &sampled{next: next, rate: rate, rand: randOf(next)}
+}
+
+func (s *sampled) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+	if !s.sample() {
+		return passed()
+	}
+	return s.next.LinearThrottle(threshold, identifier)
+}
+
+func (s *sampled) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
+	if !s.sample() {
+		return passed()
+	}
+	return s.next.ExponentialThrottle(threshold, identifier)
+}
+
+func (s *sampled) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	if !s.sample() {
+		return passed()
+	}
+	return LinearThrottleCtx(ctx, s.next, threshold, identifier)
+}
+
+func (s *sampled) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	if !s.sample() {
+		return passed()
+	}
+	return ExponentialThrottleCtx(ctx, s.next, threshold, identifier)
+}
+
+// Close closes the wrapped Throttler in case it implements Closer.
+func (s *sampled) Close(ctx context.Context) error {
+	if c, ok := s.next.(Closer); ok {
+		return c.Close(ctx)
+	}
+	return nil
+}
+
+// sample reports whether the current call is to be enforced.
+func (s *sampled) sample() bool {
+	if s.rate >= 1 {
+		return true
+	}
+	if s.rate <= 0 {
+		return false
+	}
+	f, err := randomFloat(s.rand)
+	if err != nil {
+		return true
+	}
+	return f < s.rate
+}
+
+func passed() <-chan Result {
+	out := make(chan Result, 1)
+	out <- Result{}
+	close(out)
+	return out
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+type countingThrottler struct {
+	NoopRatelimiter
+	lock  sync.Mutex
+	calls int
+}
+
+func (c *countingThrottler) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.calls++
+	return passed()
+}
+
+func TestSampled(t *testing.T) {
+	tests := []struct {
+		rate      float64
+		tolerance float64
+	}{
+		{0, 0},
+		{0.1, 0.02},
+		{0.5, 0.03},
+		{1, 0},
+	}
+	for _, test := range tests {
+		counter := &countingThrottler{}
+		throttler := Sampled(counter, test.rate)
+		const total = 10000
+		for i := 0; i < total; i++ {
+			if result := <-LinearThrottleCtx(context.Background(), throttler, time.Second, "id"); result.Error != nil {
+				t.Errorf("Unexpected error %v", result.Error)
+			}
+		}
+		if frequency := float64(counter.calls) / total; math.Abs(frequency-test.rate) > test.tolerance {
+			t.Errorf("Expected frequency of about %v, got %v", test.rate, frequency)
+		}
+	}
+}
+
+func TestSampled_RandReader(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := ratelimitertest.NewRecordingCache(clock)
+	// reading only 0xff yields numbers close to 1, so no call is sampled
+	limiter, _ := NewLimiter(time.Hour, cache, WithClock(clock), WithRandReader(bytes.NewReader(bytes.Repeat([]byte{0xff}, 1024))))
+	throttler := Sampled(limiter, 0.5)
+	for i := 0; i < 10; i++ {
+		<-throttler.LinearThrottle(time.Minute, "id")
+	}
+	if calls := cache.Calls(); len(calls) != 0 {
+		t.Errorf("Expected no calls to be sampled, got %v", calls)
+	}
+}
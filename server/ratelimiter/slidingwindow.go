@@ -0,0 +1,147 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// SlidingWindow is a Throttler that allows up to `limit` calls for the same
+// identifier within any window of `threshold`. Calls exceeding the limit are
+// delayed until the oldest call in the window has left it.
+type SlidingWindow struct {
+	options
+	limit int
+	cache GetSetter
+}
+
+// windowItem stores the times at which calls have been admitted. Items are
+// stored as pointers and never mutated after being stored so that they
+// can be compared by atomic cache updates.
+type windowItem struct {
+	calls []time.Time
+}
+
+// LinearThrottle returns a channel that blocks until less than the
+// configured limit of calls have been made within the last threshold.
+func (s *SlidingWindow) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return s.LinearThrottleCtx(context.Background(), threshold, identifier)
+}
+
+// ExponentialThrottle behaves exactly like LinearThrottle as a sliding
+// window has no notion of a queue that could grow exponentially.
+func (s *SlidingWindow) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return s.LinearThrottleCtx(context.Background(), threshold, identifier)
+}
+
+// LinearThrottleCtx works like LinearThrottle, but stops waiting as soon as
+// the given context is cancelled.
+func (s *SlidingWindow) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return s.throttle(ctx, threshold, identifier)
+}
+
+// ExponentialThrottleCtx behaves exactly like LinearThrottleCtx.
+func (s *SlidingWindow) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return s.throttle(ctx, threshold, identifier)
+}
+
+func (s *SlidingWindow) throttle(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	hashedIdentifier := s.hash(identifier)
+	var d decision
+	return s.runWith(ctx, hashedIdentifier, &d, s.guard(s.cache, hashedIdentifier, func() (time.Duration, error) {
+		return s.allow(threshold, hashedIdentifier, &d.used)
+	}))
+}
+
+func (s *SlidingWindow) allow(threshold time.Duration, hashedIdentifier string, used *float64) (time.Duration, error) {
+	if threshold <= 0 {
+		return 0, ErrInvalidThreshold
+	}
+	for {
+		now := s.clock.Now()
+		var previous interface{}
+		var calls []time.Time
+		value, found, err := getErr(s.cache, hashedIdentifier)
+		if err != nil {
+			return s.handleReadError(err)
+		}
+		if found {
+			item, ok := decodeWindowItem(value)
+			if ok {
+				s.hit()
+				previous = value
+				calls = item.calls
+			} else if err := s.handleInvalidValue(value); err != nil {
+				return 0, err
+			} else {
+				previous = replace
+			}
+		} else {
+			s.miss()
+		}
+
+		calls = prune(calls, now.Add(-threshold), s.limit)
+
+		admitAt := now
+		if len(calls) >= s.limit {
+			// calls that have been delayed are recorded using the time
+			// they will be admitted at, so the entries are always sorted
+			admitAt = calls[len(calls)-s.limit].Add(threshold)
+		}
+		delay := admitAt.Sub(now)
+		if delay > s.timeout {
+			return delay, deadlineExceeded(hashedIdentifier, delay, s.timeout)
+		}
+
+		stored := s.roundUp(admitAt)
+		next := &windowItem{calls: append(calls, stored)}
+		expiry := stored.Add(threshold).Sub(now)
+		ok, err := update(s.cache, hashedIdentifier, previous, next, expiry)
+		if err != nil {
+			return s.handleCacheError(err)
+		}
+		if !ok {
+			continue
+		}
+		reportUsage(used, float64(len(next.calls))/float64(s.limit))
+		return delay, nil
+	}
+}
+
+// prune returns a copy of the given calls, skipping all calls made before
+// the given cutoff. As only the most recent `limit` calls are relevant
+// for computing delays, older ones are skipped too, which keeps the
+// number of stored calls bounded.
+func prune(calls []time.Time, cutoff time.Time, limit int) []time.Time {
+	start := 0
+	for start < len(calls) && !calls[start].After(cutoff) {
+		start++
+	}
+	if len(calls)-start > limit {
+		start = len(calls) - limit
+	}
+	result := make([]time.Time, len(calls)-start, len(calls)-start+1)
+	copy(result, calls[start:])
+	return result
+}
+
+// NewSlidingWindow creates a new SlidingWindow. `limit` defines the number
+// of calls that can be made for the same identifier within the threshold
+// passed when throttling and must be positive.
+func NewSlidingWindow(limit int, timeout time.Duration, cache GetSetter, opts ...Option) (*SlidingWindow, error) {
+	if limit < 1 {
+		return nil, errors.New("ratelimiter: limit must be positive")
+	}
+	o, err := newOptions(append([]Option{WithTimeout(timeout)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &SlidingWindow{
+		options: o,
+		limit:   limit,
+		cache:   cache,
+	}, nil
+}
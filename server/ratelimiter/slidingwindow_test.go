@@ -0,0 +1,123 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestSlidingWindow_LinearThrottle(t *testing.T) {
+	tests := []struct {
+		name           string
+		limit          int
+		calls          int
+		expectedDelays int
+	}{
+		{
+			"within limit",
+			3,
+			3,
+			0,
+		},
+		{
+			"exceeding limit",
+			3,
+			4,
+			1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			window, _ := NewSlidingWindow(test.limit, time.Hour, &mockGetSetter{})
+			delays := 0
+			for i := 0; i < test.calls; i++ {
+				result := <-window.LinearThrottle(time.Millisecond*50, test.name)
+				if result.Error != nil {
+					t.Fatalf("Unexpected error %v", result.Error)
+				}
+				if result.Delay > 0 {
+					delays++
+				}
+			}
+			if delays != test.expectedDelays {
+				t.Errorf("Expected %d delayed calls, got %d", test.expectedDelays, delays)
+			}
+		})
+	}
+
+	t.Run("exceeding deadline", func(t *testing.T) {
+		window, _ := NewSlidingWindow(1, time.Millisecond, &mockGetSetter{})
+		<-window.LinearThrottle(time.Second, "deadline")
+		if result := <-window.LinearThrottle(time.Second, "deadline"); !errors.Is(result.Error, ErrWouldExceedDeadline) {
+			t.Errorf("Expected %v, got %v", ErrWouldExceedDeadline, result.Error)
+		}
+	})
+}
+
+func TestSlidingWindow_TimePrecision(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, int(time.Millisecond*300), time.UTC))
+	cache := &mockGetSetter{}
+	window, _ := NewSlidingWindow(1, time.Hour, cache, WithClock(clock), WithTimePrecision(time.Second))
+	key := window.hash("precision")
+
+	if delay, err := window.allow(time.Second, key, nil); delay != 0 || err != nil {
+		t.Errorf("Expected %v, %v, got %v, %v", 0, nil, delay, err)
+	}
+	delay, err := window.allow(time.Second, key, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if delay < time.Second || delay > time.Second*2 {
+		t.Errorf("Expected delay within one unit of precision, got %v", delay)
+	}
+	value, _ := cache.Get(key)
+	item, _ := decodeWindowItem(value)
+	for _, call := range item.calls {
+		if call.Nanosecond() != 0 {
+			t.Errorf("Expected stored timestamp to be rounded, got %v", call)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		calls    []time.Time
+		limit    int
+		expected []time.Time
+	}{
+		{
+			"empty",
+			nil,
+			2,
+			[]time.Time{},
+		},
+		{
+			"outdated",
+			[]time.Time{now.Add(-time.Hour), now.Add(-time.Minute), now},
+			5,
+			[]time.Time{now.Add(-time.Minute), now},
+		},
+		{
+			"bounded",
+			[]time.Time{now.Add(-time.Minute), now, now.Add(time.Minute)},
+			2,
+			[]time.Time{now, now.Add(time.Minute)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := prune(test.calls, now.Add(-time.Minute*30), test.limit)
+			if !reflect.DeepEqual(test.expected, result) {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+// Lener can optionally be implemented by a GetSetter in order to report
+// the number of values it currently stores.
+type Lener interface {
+	Len() int
+}
+
+// Enumerator can optionally be implemented by a GetSetter in order to
+// report the keys it currently stores.
+type Enumerator interface {
+	Keys() []string
+}
+
+// Sizer can optionally be implemented by a GetSetter in order to report
+// an estimate of the memory its values occupy in bytes.
+type Sizer interface {
+	ApproximateSize() int
+}
+
+// Stats contains information about the identifiers tracked by a throttler.
+// Stats are best effort: when caches do not support reporting a value,
+// the respective `Has` field is false.
+type Stats struct {
+	ActiveKeys      int
+	HasActiveKeys   bool
+	ApproximateSize int
+	HasSize         bool
+}
+
+// Stats returns information about the identifiers that are currently being
+// tracked in the underlying cache. In case the cache is shared with other
+// users, the values returned include their values too.
+func (l *Limiter) Stats() Stats {
+	return stats(l.cache)
+}
+
+func stats(cache GetSetter) Stats {
+	var s Stats
+	switch c := cache.(type) {
+	case Lener:
+		s.ActiveKeys, s.HasActiveKeys = c.Len(), true
+	case Enumerator:
+		s.ActiveKeys, s.HasActiveKeys = len(c.Keys()), true
+	}
+	if c, ok := cache.(Sizer); ok {
+		s.ApproximateSize, s.HasSize = c.ApproximateSize(), true
+	}
+	return s
+}
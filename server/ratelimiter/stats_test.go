@@ -0,0 +1,63 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+type mockLenGetSetter struct {
+	GetSetter
+	len int
+}
+
+func (m *mockLenGetSetter) Len() int {
+	return m.len
+}
+
+type mockEnumeratorGetSetter struct {
+	GetSetter
+	keys []string
+}
+
+func (m *mockEnumeratorGetSetter) Keys() []string {
+	return m.keys
+}
+
+func (m *mockEnumeratorGetSetter) ApproximateSize() int {
+	return len(m.keys) * 100
+}
+
+func TestLimiter_Stats(t *testing.T) {
+	tests := []struct {
+		name     string
+		cache    GetSetter
+		expected Stats
+	}{
+		{
+			"unsupported",
+			&mockGetSetter{},
+			Stats{},
+		},
+		{
+			"len",
+			&mockLenGetSetter{&mockGetSetter{}, 12},
+			Stats{ActiveKeys: 12, HasActiveKeys: true},
+		},
+		{
+			"keys and size",
+			&mockEnumeratorGetSetter{&mockGetSetter{}, []string{"a", "b"}},
+			Stats{ActiveKeys: 2, HasActiveKeys: true, ApproximateSize: 200, HasSize: true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter, _ := NewLimiter(time.Second, test.cache)
+			if result := limiter.Stats(); result != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build go1.18
+// +build go1.18
+
+package ratelimiter
+
+import (
+	"encoding"
+	"time"
+)
+
+// Store is a cache holding values of a single type, which allows
+// implementations to be checked at compile time instead of asserting
+// the type of values returned from a GetSetter.
+type Store[T any] interface {
+	Get(key string) (T, bool)
+	Set(key string, value T, expiry time.Duration)
+}
+
+// FromStore returns a GetSetter that can be used by all throttlers and
+// that is backed by the given Store of encoded values. As all values stored
+// by throttlers implement encoding.BinaryMarshaler, implementations only
+// need to deal with bytes.
+func FromStore(s Store[[]byte]) GetSetter {
+	return &storeGetSetter{store: s}
+}
+
+type storeGetSetter struct {
+	store Store[[]byte]
+}
+
+func (s *storeGetSetter) Get(key string) (interface{}, bool) {
+	value, ok := s.store.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return value, true
+}
+
+func (s *storeGetSetter) Set(key string, value interface{}, expiry time.Duration) {
+	s.SetErr(key, value, expiry)
+}
+
+func (s *storeGetSetter) SetErr(key string, value interface{}, expiry time.Duration) error {
+	m, ok := value.(encoding.BinaryMarshaler)
+	if !ok {
+		return ErrInvalidCache
+	}
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	s.store.Set(key, data, expiry)
+	return nil
+}
+
+// AsStore returns a Store of type T that is backed by the given GetSetter,
+// so existing caches can be used where a Store is expected. Values of a
+// different type are reported as not found.
+func AsStore[T any](c GetSetter) Store[T] {
+	return &getSetterStore[T]{cache: c}
+}
+
+type getSetterStore[T any] struct {
+	cache GetSetter
+}
+
+func (g *getSetterStore[T]) Get(key string) (T, bool) {
+	var zero T
+	value, found := g.cache.Get(key)
+	if !found {
+		return zero, false
+	}
+	typed, ok := value.(T)
+	if !ok {
+		return zero, false
+	}
+	return typed, true
+}
+
+func (g *getSetterStore[T]) Set(key string, value T, expiry time.Duration) {
+	g.cache.Set(key, value, expiry)
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build go1.18
+// +build go1.18
+
+package ratelimiter
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockStore struct {
+	lock   sync.Mutex
+	values map[string][]byte
+}
+
+func (m *mockStore) Get(key string) ([]byte, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	v, ok := m.values[key]
+	return v, ok
+}
+
+func (m *mockStore) Set(key string, value []byte, expiry time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.values == nil {
+		m.values = map[string][]byte{}
+	}
+	m.values[key] = value
+}
+
+func TestFromStore(t *testing.T) {
+	limiter, _ := NewLimiter(time.Hour, FromStore(&mockStore{}))
+	if ok, _, err := limiter.LinearAllow(time.Minute, "store"); !ok || err != nil {
+		t.Errorf("Expected first call to be allowed, got %v", err)
+	}
+	if _, limited := limiter.Peek("store"); !limited {
+		t.Error("Expected limit to be stored")
+	}
+	if err := FromStore(&mockStore{}).(SetErrer).SetErr("key", "plain", time.Minute); err != ErrInvalidCache {
+		t.Errorf("Expected %v, got %v", ErrInvalidCache, err)
+	}
+}
+
+func TestAsStore(t *testing.T) {
+	cache := &mockGetSetter{}
+	cache.Set("other", 12, time.Minute)
+	store := AsStore[string](cache)
+
+	store.Set("key", "value", time.Minute)
+	if value, ok := store.Get("key"); !ok || value != "value" {
+		t.Errorf("Unexpected value %v", value)
+	}
+	if _, ok := store.Get("other"); ok {
+		t.Error("Expected value of different type not to be found")
+	}
+	if _, ok := store.Get("unknown"); ok {
+		t.Error("Unexpected value for unknown key")
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"time"
+)
+
+// TaggedResult is a Result that also carries the raw identifier it has been
+// created for, so results of many concurrent calls can be received using a
+// single channel or select loop.
+type TaggedResult struct {
+	Result
+	Identifier string
+}
+
+// LinearThrottleTagged linearly throttles the given identifier using the
+// given Throttler and tags the result with the identifier as passed.
+func LinearThrottleTagged(ctx context.Context, t Throttler, threshold time.Duration, identifier string) <-chan TaggedResult {
+	return tag(identifier, LinearThrottleCtx(ctx, t, threshold, identifier))
+}
+
+// ExponentialThrottleTagged works like LinearThrottleTagged but throttles
+// using exponentially increasing thresholds.
+func ExponentialThrottleTagged(ctx context.Context, t Throttler, threshold time.Duration, identifier string) <-chan TaggedResult {
+	return tag(identifier, ExponentialThrottleCtx(ctx, t, threshold, identifier))
+}
+
+func tag(identifier string, in <-chan Result) <-chan TaggedResult {
+	out := make(chan TaggedResult, 1)
+	go func() {
+		defer close(out)
+		out <- TaggedResult{Result: <-in, Identifier: identifier}
+	}()
+	return out
+}
@@ -0,0 +1,37 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLinearThrottleTagged(t *testing.T) {
+	limiter, _ := NewLimiter(time.Millisecond, &mockGetSetter{})
+	<-limiter.LinearThrottle(time.Minute, "b")
+
+	a := LinearThrottleTagged(context.Background(), limiter, time.Minute, "a")
+	b := ExponentialThrottleTagged(context.Background(), limiter, time.Minute, "b")
+
+	results := map[string]error{}
+	for i := 0; i < 2; i++ {
+		var result TaggedResult
+		select {
+		case result = <-a:
+			a = nil
+		case result = <-b:
+			b = nil
+		}
+		results[result.Identifier] = result.Error
+	}
+	if err, ok := results["a"]; !ok || err != nil {
+		t.Errorf("Expected %v for a, got %v", nil, err)
+	}
+	if err, ok := results["b"]; !ok || !errors.Is(err, ErrWouldExceedDeadline) {
+		t.Errorf("Expected %v for b, got %v", ErrWouldExceedDeadline, err)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"time"
+)
+
+// TieredCache is a GetSetter that layers a fast local cache in front of a
+// slower, authoritative cache like Redis. Values are read from the local
+// cache first and written to both caches. Values are kept in the local
+// cache for the given local TTL at most, which bounds the time a value can
+// be stale in case it has been updated by another instance. This trades
+// accuracy for latency, as an instance reading a stale local value can
+// briefly under-count calls made using other instances. Atomic updates
+// are performed using the authoritative cache, refreshing the local value
+// in case they fail.
+type TieredCache struct {
+	local    GetSetter
+	remote   GetSetter
+	localTTL time.Duration
+}
+
+// NewTieredCache creates a new TieredCache keeping values read from or
+// written to remote in local for localTTL at most.
+func NewTieredCache(local, remote GetSetter, localTTL time.Duration) *TieredCache {
+	return &TieredCache{
+		local:    local,
+		remote:   remote,
+		localTTL: localTTL,
+	}
+}
+
+// Get returns the value stored for the given key, reading it from the
+// authoritative cache in case it is not cached locally.
+func (t *TieredCache) Get(key string) (interface{}, bool) {
+	value, found, _ := t.GetErr(key)
+	return value, found
+}
+
+// GetErr works like Get, but returns an error in case the authoritative
+// cache implements GetErrer and fails to read the value.
+func (t *TieredCache) GetErr(key string) (interface{}, bool, error) {
+	if value, found := t.local.Get(key); found {
+		return value, true, nil
+	}
+	return t.refresh(key)
+}
+
+// Set stores the given value in both caches.
+func (t *TieredCache) Set(key string, value interface{}, expiry time.Duration) {
+	t.remote.Set(key, value, expiry)
+	t.setLocal(key, value, expiry)
+}
+
+// SetErr stores the given value in both caches, returning an error in case
+// the authoritative cache fails to store it.
+func (t *TieredCache) SetErr(key string, value interface{}, expiry time.Duration) error {
+	if s, ok := t.remote.(SetErrer); ok {
+		if err := s.SetErr(key, value, expiry); err != nil {
+			return err
+		}
+	} else {
+		t.remote.Set(key, value, expiry)
+	}
+	t.setLocal(key, value, expiry)
+	return nil
+}
+
+// Add stores the given value in case the authoritative cache does not
+// store a value for the given key yet. In case the authoritative cache
+// does not implement Adder, the value is stored unconditionally.
+func (t *TieredCache) Add(key string, value interface{}, expiry time.Duration) (bool, error) {
+	a, ok := t.remote.(Adder)
+	if !ok {
+		return true, t.SetErr(key, value, expiry)
+	}
+	added, err := a.Add(key, value, expiry)
+	if err != nil {
+		return false, err
+	}
+	if !added {
+		t.refresh(key)
+		return false, nil
+	}
+	t.setLocal(key, value, expiry)
+	return true, nil
+}
+
+// CompareAndSwap replaces the value stored for the given key in case the
+// authoritative cache still stores the given old value. In case the
+// authoritative cache does not implement CompareAndSwapper, the value is
+// stored unconditionally.
+func (t *TieredCache) CompareAndSwap(key string, old, new interface{}, expiry time.Duration) bool {
+	cas, ok := t.remote.(CompareAndSwapper)
+	if !ok {
+		t.Set(key, new, expiry)
+		return true
+	}
+	if !cas.CompareAndSwap(key, old, new, expiry) {
+		// the local value might have been stale, so the next attempt
+		// needs to use the authoritative one
+		t.refresh(key)
+		return false
+	}
+	t.setLocal(key, new, expiry)
+	return true
+}
+
+// Delete removes the value stored for the given key from both caches in
+// case they implement Deleter.
+func (t *TieredCache) Delete(key string) {
+	if d, ok := t.remote.(Deleter); ok {
+		d.Delete(key)
+	}
+	if d, ok := t.local.(Deleter); ok {
+		d.Delete(key)
+	}
+}
+
+// refresh reads the value stored for the given key from the authoritative
+// cache and stores it in the local cache.
+func (t *TieredCache) refresh(key string) (interface{}, bool, error) {
+	value, found, err := getErr(t.remote, key)
+	if err != nil {
+		return nil, false, err
+	}
+	if !found {
+		if d, ok := t.local.(Deleter); ok {
+			d.Delete(key)
+		}
+		return nil, false, nil
+	}
+	t.local.Set(key, value, t.localTTL)
+	return value, true, nil
+}
+
+func (t *TieredCache) setLocal(key string, value interface{}, expiry time.Duration) {
+	if expiry > t.localTTL {
+		expiry = t.localTTL
+	}
+	t.local.Set(key, value, expiry)
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestTieredCache(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	local := ratelimitertest.NewRecordingCache(clock)
+	remote := ratelimitertest.NewRecordingCache(clock)
+	cache := NewTieredCache(local, remote, time.Second)
+
+	cache.Set("key", "value", time.Minute)
+	if value, found := remote.Get("key"); !found || value != "value" {
+		t.Errorf("Expected write to propagate, got %v", value)
+	}
+
+	calls := len(remote.Calls())
+	for i := 0; i < 3; i++ {
+		if value, found := cache.Get("key"); !found || value != "value" {
+			t.Errorf("Unexpected value %v", value)
+		}
+	}
+	if n := len(remote.Calls()) - calls; n != 0 {
+		t.Errorf("Expected reads to hit local cache, got %d remote calls", n)
+	}
+
+	remote.Set("key", "other", time.Minute)
+	if value, _ := cache.Get("key"); value != "value" {
+		t.Errorf("Expected stale local value, got %v", value)
+	}
+	clock.Advance(time.Second)
+	if value, _ := cache.Get("key"); value != "other" {
+		t.Errorf("Expected local value to expire, got %v", value)
+	}
+
+	remote.Set("key", "next", time.Minute)
+	if cache.CompareAndSwap("key", "other", "swapped", time.Minute) {
+		t.Error("Expected swap of stale value to fail")
+	}
+	if value, _ := cache.Get("key"); value != "next" {
+		t.Errorf("Expected failed swap to refresh local value, got %v", value)
+	}
+	if !cache.CompareAndSwap("key", "next", "swapped", time.Minute) {
+		t.Error("Expected swap to succeed")
+	}
+
+	cache.Delete("key")
+	if _, found := cache.Get("key"); found {
+		t.Error("Expected value to be deleted")
+	}
+	expected := []ratelimitertest.Call{{Op: "Delete", Key: "key"}, {Op: "Get", Key: "key"}}
+	if calls := remote.Calls(); !reflect.DeepEqual(calls[len(calls)-2:], expected) {
+		t.Errorf("Expected %v, got %v", expected, calls[len(calls)-2:])
+	}
+}
+
+func TestTieredCache_Limiter(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	remote := ratelimitertest.NewRecordingCache(clock)
+	salt := WithSalt([]byte("salt"))
+	a, _ := NewLimiter(time.Hour, NewTieredCache(ratelimitertest.NewRecordingCache(clock), remote, time.Second), salt, WithClock(clock))
+	b, _ := NewLimiter(time.Hour, NewTieredCache(ratelimitertest.NewRecordingCache(clock), remote, time.Second), salt, WithClock(clock))
+
+	if _, delay, _ := a.LinearAllow(time.Minute, "shared"); delay != 0 {
+		t.Errorf("Expected %v, got %v", 0, delay)
+	}
+	if _, delay, _ := b.LinearAllow(time.Minute, "shared"); delay != time.Minute {
+		t.Errorf("Expected %v, got %v", time.Minute, delay)
+	}
+	if _, delay, _ := a.LinearAllow(time.Minute, "shared"); delay != time.Minute*2 {
+		t.Errorf("Expected %v, got %v", time.Minute*2, delay)
+	}
+}
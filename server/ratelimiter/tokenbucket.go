@@ -0,0 +1,169 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// TokenBucket is a Throttler that allows bursts of calls for the same
+// identifier. Each identifier owns a bucket holding up to `capacity` tokens,
+// where each call consumes a token and one token is refilled per
+// `threshold`. Calls are only delayed when the bucket is empty.
+type TokenBucket struct {
+	options
+	capacity int
+	cache    GetSetter
+}
+
+type bucketItem struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+// LinearThrottle returns a channel that blocks until a token is available
+// for the given identifier, refilling one token per threshold. The returned
+// channel behaves like the one returned by `Limiter`.
+func (t *TokenBucket) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return t.LinearThrottleCtx(context.Background(), threshold, identifier)
+}
+
+// ExponentialThrottle behaves exactly like LinearThrottle as a token bucket
+// has no notion of a queue that could grow exponentially.
+func (t *TokenBucket) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return t.LinearThrottleCtx(context.Background(), threshold, identifier)
+}
+
+// LinearThrottleCtx works like LinearThrottle, but stops waiting as soon as
+// the given context is cancelled.
+func (t *TokenBucket) LinearThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return t.throttle(ctx, threshold, identifier, 1)
+}
+
+// ExponentialThrottleCtx behaves exactly like LinearThrottleCtx.
+func (t *TokenBucket) ExponentialThrottleCtx(ctx context.Context, threshold time.Duration, identifier string) <-chan Result {
+	return t.throttle(ctx, threshold, identifier, 1)
+}
+
+// LinearThrottleCost works like LinearThrottle, but consumes the given
+// number of tokens instead of a single one, so expensive operations use
+// up more of the available budget. Costs smaller than 1 are rejected using
+// ErrInvalidCost.
+func (t *TokenBucket) LinearThrottleCost(threshold time.Duration, identifier string, cost int) <-chan Result {
+	if cost < 1 {
+		hashedIdentifier := t.hash(identifier)
+		return t.run(context.Background(), hashedIdentifier, func() (time.Duration, error) {
+			return 0, ErrInvalidCost
+		})
+	}
+	return t.throttle(context.Background(), threshold, identifier, cost)
+}
+
+// LinearAllowCost performs the same checks and updates as
+// LinearThrottleCost but never blocks. In case the call would be throttled,
+// false is returned alongside the delay the caller is required to wait for.
+// The tokens are consumed nonetheless.
+func (t *TokenBucket) LinearAllowCost(threshold time.Duration, identifier string, cost int) (bool, time.Duration, error) {
+	hashedIdentifier := t.hash(identifier)
+	if cost < 1 {
+		_, err := t.check(hashedIdentifier, func() (time.Duration, error) {
+			return 0, ErrInvalidCost
+		})
+		return false, 0, err
+	}
+	delay, err := t.check(hashedIdentifier, t.guard(t.cache, hashedIdentifier, func() (time.Duration, error) {
+		return t.allow(threshold, hashedIdentifier, cost, nil)
+	}))
+	return err == nil && delay == 0, delay, err
+}
+
+func (t *TokenBucket) throttle(ctx context.Context, threshold time.Duration, identifier string, cost int) <-chan Result {
+	hashedIdentifier := t.hash(identifier)
+	var d decision
+	return t.runWith(ctx, hashedIdentifier, &d, t.guard(t.cache, hashedIdentifier, func() (time.Duration, error) {
+		return t.allow(threshold, hashedIdentifier, cost, &d.used)
+	}))
+}
+
+// allow consumes cost tokens, storing the fraction of the bucket that is
+// used up afterwards in used unless it is nil.
+func (t *TokenBucket) allow(threshold time.Duration, hashedIdentifier string, cost int, used *float64) (time.Duration, error) {
+	if threshold <= 0 {
+		return 0, ErrInvalidThreshold
+	}
+	for {
+		now := t.clock.Now()
+		var previous interface{}
+		item := bucketItem{tokens: float64(t.capacity), lastRefill: now}
+		value, found, err := getErr(t.cache, hashedIdentifier)
+		if err != nil {
+			return t.handleReadError(err)
+		}
+		if found {
+			stored, ok := decodeBucketItem(value)
+			if ok {
+				t.hit()
+				previous = value
+				item = stored
+			} else if err := t.handleInvalidValue(value); err != nil {
+				return 0, err
+			} else {
+				previous = replace
+			}
+		} else {
+			t.miss()
+		}
+
+		// tokens are refilled based on the time that has elapsed since
+		// the last call, but never exceed the bucket's capacity
+		refilled := float64(elapsed(now, item.lastRefill)) / float64(threshold)
+		tokens := item.tokens + refilled
+		if tokens > float64(t.capacity) {
+			tokens = float64(t.capacity)
+		}
+		tokens -= float64(cost)
+
+		var delay time.Duration
+		if tokens < 0 {
+			// a negative number of tokens describes calls that
+			// are waiting for a token to be refilled
+			delay = time.Duration(-tokens * float64(threshold))
+			if delay > t.timeout {
+				return delay, deadlineExceeded(hashedIdentifier, delay, t.timeout)
+			}
+		}
+
+		next := bucketItem{tokens: tokens, lastRefill: now}
+		expiry := time.Duration((float64(t.capacity) - tokens) * float64(threshold))
+		ok, err := update(t.cache, hashedIdentifier, previous, next, expiry)
+		if err != nil {
+			return t.handleCacheError(err)
+		}
+		if !ok {
+			continue
+		}
+		reportUsage(used, 1-tokens/float64(t.capacity))
+		return delay, nil
+	}
+}
+
+// NewTokenBucket creates a new TokenBucket. `capacity` defines the number
+// of calls that can be made in a burst for the same identifier before calls
+// are being delayed and must be positive.
+func NewTokenBucket(capacity int, timeout time.Duration, cache GetSetter, opts ...Option) (*TokenBucket, error) {
+	if capacity < 1 {
+		return nil, errors.New("ratelimiter: capacity must be positive")
+	}
+	o, err := newOptions(append([]Option{WithTimeout(timeout)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenBucket{
+		options:  o,
+		capacity: capacity,
+		cache:    cache,
+	}, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestTokenBucket_LinearThrottle(t *testing.T) {
+	tests := []struct {
+		name           string
+		capacity       int
+		calls          int
+		expectedDelays int
+	}{
+		{
+			"within capacity",
+			3,
+			3,
+			0,
+		},
+		{
+			"exceeding capacity",
+			3,
+			5,
+			2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bucket, _ := NewTokenBucket(test.capacity, time.Hour, &mockGetSetter{})
+			delays := 0
+			for i := 0; i < test.calls; i++ {
+				result := <-bucket.LinearThrottle(time.Millisecond*50, test.name)
+				if result.Error != nil {
+					t.Fatalf("Unexpected error %v", result.Error)
+				}
+				if result.Delay > 0 {
+					delays++
+				}
+			}
+			if delays != test.expectedDelays {
+				t.Errorf("Expected %d delayed calls, got %d", test.expectedDelays, delays)
+			}
+		})
+	}
+
+	t.Run("exceeding deadline", func(t *testing.T) {
+		bucket, _ := NewTokenBucket(1, time.Millisecond, &mockGetSetter{})
+		<-bucket.LinearThrottle(time.Second, "deadline")
+		if result := <-bucket.LinearThrottle(time.Second, "deadline"); !errors.Is(result.Error, ErrWouldExceedDeadline) {
+			t.Errorf("Expected %v, got %v", ErrWouldExceedDeadline, result.Error)
+		}
+	})
+}
+
+func TestTokenBucket_LinearThrottleCost(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	bucket, _ := NewTokenBucket(5, time.Hour, &mockGetSetter{}, WithClock(clock))
+
+	if result := <-bucket.LinearThrottleCost(time.Second, "cost", 0); result.Error != ErrInvalidCost {
+		t.Errorf("Expected %v, got %v", ErrInvalidCost, result.Error)
+	}
+	if result := <-bucket.LinearThrottleCost(time.Second, "cost", 4); result.Error != nil || result.Delay != 0 {
+		t.Errorf("Unexpected result %v", result)
+	}
+	if delay, err := bucket.allow(time.Second, bucket.hash("cost"), 3, nil); err != nil || delay != time.Second*2 {
+		t.Errorf("Expected delay of 2s, got %v, %v", delay, err)
+	}
+	if _, _, err := bucket.LinearAllowCost(time.Second, "cost", 0); err != ErrInvalidCost {
+		t.Errorf("Expected %v, got %v", ErrInvalidCost, err)
+	}
+	if ok, delay, err := bucket.LinearAllowCost(time.Second, "cost", 2); ok || delay != time.Second*4 || err != nil {
+		t.Errorf("Unexpected result %v, %v, %v", ok, delay, err)
+	}
+}
+
+func TestTokenBucket_LinearThrottleCost_CircuitBreaker(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	bucket, _ := NewTokenBucket(2, time.Millisecond, &mockGetSetter{}, WithClock(clock), WithCircuitBreaker(1, time.Minute))
+
+	expected := []error{nil, ErrWouldExceedDeadline, ErrOpen}
+	for i, expectedError := range expected {
+		if result := <-bucket.LinearThrottleCost(time.Second, "breaker", 2); !errors.Is(result.Error, expectedError) {
+			t.Errorf("Call %d: expected %v, got %v", i, expectedError, result.Error)
+		}
+	}
+}
+
+func TestTokenBucket_ClockSetBack(t *testing.T) {
+	clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	bucket, _ := NewTokenBucket(1, time.Hour*48, &mockGetSetter{}, WithClock(clock))
+	key := bucket.hash("clock")
+
+	bucket.allow(time.Minute, key, 1, nil)
+	clock.Advance(-time.Hour * 24)
+	if delay, err := bucket.allow(time.Minute, key, 1, nil); err != nil || delay > time.Minute {
+		t.Errorf("Expected delay to be bounded by %v, got %v, %v", time.Minute, delay, err)
+	}
+}
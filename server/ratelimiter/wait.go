@@ -0,0 +1,40 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// WaitThenDo linearly throttles the given identifier using the given
+// Throttler and calls fn once the call has been admitted, returning its
+// error. In case the call would exceed the throttler's timeout, it is
+// retried using exponential backoff starting at threshold until it is
+// admitted or the context is done, waiting using the throttler's clock.
+// Other errors are returned as is.
+func WaitThenDo(ctx context.Context, t Throttler, threshold time.Duration, identifier string, fn func() error) error {
+	clock := clockOf(t)
+	backoff := threshold
+	for {
+		result := <-LinearThrottleCtx(ctx, t, threshold, identifier)
+		if result.Error == nil {
+			return fn()
+		}
+		if !errors.Is(result.Error, ErrWouldExceedDeadline) {
+			return result.Error
+		}
+		// there is no point in waiting longer than the delay that
+		// has been required when the call was rejected
+		wait := backoff
+		if result.Delay > 0 && wait > result.Delay {
+			wait = result.Delay
+		}
+		if err := sleep(ctx, clock, wait); err != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter/ratelimitertest"
+)
+
+func TestWaitThenDo(t *testing.T) {
+	t.Run("retry", func(t *testing.T) {
+		limiter, _ := NewLimiter(time.Millisecond, &mockGetSetter{})
+		<-limiter.LinearThrottle(time.Millisecond*20, "wait")
+
+		called := false
+		err := WaitThenDo(context.Background(), limiter, time.Millisecond*20, "wait", func() error {
+			called = true
+			return nil
+		})
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if !called {
+			t.Error("Expected function to be called")
+		}
+	})
+	t.Run("clock", func(t *testing.T) {
+		clock := ratelimitertest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		limiter, _ := NewLimiter(time.Millisecond, &mockGetSetter{}, WithClock(clock))
+		limiter.LinearAllow(time.Minute, "wait")
+
+		done := make(chan error)
+		go func() {
+			done <- WaitThenDo(context.Background(), limiter, time.Minute, "wait", func() error {
+				return nil
+			})
+		}()
+		for clock.Waiters() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		clock.Advance(time.Minute)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Error("Expected retry to wait using the limiter's clock")
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		limiter, _ := NewLimiter(time.Hour, &mockGetSetter{})
+		errFn := errors.New("did not work")
+		if err := WaitThenDo(context.Background(), limiter, time.Second, "wait", func() error {
+			return errFn
+		}); err != errFn {
+			t.Errorf("Expected %v, got %v", errFn, err)
+		}
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		limiter, _ := NewLimiter(time.Millisecond, &mockGetSetter{})
+		<-limiter.LinearThrottle(time.Hour, "wait")
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+		defer cancel()
+		err := WaitThenDo(ctx, limiter, time.Hour, "wait", func() error {
+			t.Error("Unexpected call of function")
+			return nil
+		})
+		if err != context.DeadlineExceeded {
+			t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	})
+}